@@ -0,0 +1,238 @@
+package redis
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+// Blocking commands extend the read deadline of the connection by their timeout
+// so that a ReadTimeout shorter than the block does not break the connection.
+// Cancelling the context closes the connection.
+
+// PopPush executes the blocking BRPOPLPUSH command
+func (c *Conn) PopPush(src, dst string, timeout time.Duration) (string, error) {
+	return c.PopPushContext(context.Background(), src, dst, timeout)
+}
+
+// PopPushContext executes the blocking BRPOPLPUSH command honoring the context deadline and cancellation
+func (c *Conn) PopPushContext(ctx context.Context, src, dst string, timeout time.Duration) (string, error) {
+	p := BlankPipeline(c.db)
+	defer ReleasePipeline(p)
+	p.BRPopLPush(src, dst, c.blockTimeout(timeout))
+	return c.popString(ctx, p)
+}
+
+// Move executes the blocking BLMOVE command
+func (c *Conn) Move(src, dst string, from, to ListSide, timeout time.Duration) (string, error) {
+	return c.MoveContext(context.Background(), src, dst, from, to, timeout)
+}
+
+// MoveContext executes the blocking BLMOVE command honoring the context deadline and cancellation
+func (c *Conn) MoveContext(ctx context.Context, src, dst string, from, to ListSide, timeout time.Duration) (string, error) {
+	p := BlankPipeline(c.db)
+	defer ReleasePipeline(p)
+	p.BLMove(src, dst, from, to, c.blockTimeout(timeout))
+	return c.popString(ctx, p)
+}
+
+func (c *Conn) popString(ctx context.Context, p *Pipeline) (string, error) {
+	rep := BlankReply()
+	defer ReleaseReply(rep)
+	if err := c.DoContext(ctx, p, rep); err != nil {
+		return "", err
+	}
+	v := rep.Value().Get(0)
+	if err := v.Err(); err != nil {
+		return "", err
+	}
+	if v.IsNull() {
+		return "", new(TimeoutError)
+	}
+	return string(v.Bytes()), nil
+}
+
+// PopLeft executes the blocking BLPOP command
+func (c *Conn) PopLeft(timeout time.Duration, key string, keys ...string) (k, v string, err error) {
+	return c.PopLeftContext(context.Background(), timeout, key, keys...)
+}
+
+// PopLeftContext executes the blocking BLPOP command honoring the context deadline and cancellation
+func (c *Conn) PopLeftContext(ctx context.Context, timeout time.Duration, key string, keys ...string) (k, v string, err error) {
+	k, v, _, err = c.bpop(ctx, "BLPOP", timeout, key, keys)
+	return
+}
+
+// PopRight executes the blocking BRPOP command
+func (c *Conn) PopRight(timeout time.Duration, key string, keys ...string) (k, v string, err error) {
+	return c.PopRightContext(context.Background(), timeout, key, keys...)
+}
+
+// PopRightContext executes the blocking BRPOP command honoring the context deadline and cancellation
+func (c *Conn) PopRightContext(ctx context.Context, timeout time.Duration, key string, keys ...string) (k, v string, err error) {
+	k, v, _, err = c.bpop(ctx, "BRPOP", timeout, key, keys)
+	return
+}
+
+// PopMin executes the blocking BZPOPMIN command
+func (c *Conn) PopMin(timeout time.Duration, key string, keys ...string) (k, v string, score float64, err error) {
+	return c.bpop(context.Background(), "BZPOPMIN", timeout, key, keys)
+}
+
+// PopMinContext executes the blocking BZPOPMIN command honoring the context deadline and cancellation
+func (c *Conn) PopMinContext(ctx context.Context, timeout time.Duration, key string, keys ...string) (k, v string, score float64, err error) {
+	return c.bpop(ctx, "BZPOPMIN", timeout, key, keys)
+}
+
+// PopMax executes the blocking BZPOPMAX command
+func (c *Conn) PopMax(timeout time.Duration, key string, keys ...string) (k, v string, score float64, err error) {
+	return c.bpop(context.Background(), "BZPOPMAX", timeout, key, keys)
+}
+
+// PopMaxContext executes the blocking BZPOPMAX command honoring the context deadline and cancellation
+func (c *Conn) PopMaxContext(ctx context.Context, timeout time.Duration, key string, keys ...string) (k, v string, score float64, err error) {
+	return c.bpop(ctx, "BZPOPMAX", timeout, key, keys)
+}
+
+func (c *Conn) bpop(ctx context.Context, cmd string, timeout time.Duration, key string, keys []string) (k, v string, score float64, err error) {
+	p := BlankPipeline(c.db)
+	defer ReleasePipeline(p)
+	p.bpop(cmd, c.blockTimeout(timeout), append([]string{key}, keys...))
+	rep := BlankReply()
+	defer ReleaseReply(rep)
+	if err = c.DoContext(ctx, p, rep); err != nil {
+		return
+	}
+	value := rep.Value().Get(0)
+	if err = value.Err(); err != nil {
+		return
+	}
+	if value.IsNull() {
+		err = new(TimeoutError)
+		return
+	}
+	k = string(value.Get(0).Bytes())
+	v = string(value.Get(1).Bytes())
+	switch cmd {
+	case "BZPOPMAX", "BZPOPMIN":
+		score, _ = value.Get(2).Float()
+	default:
+		score = math.NaN()
+	}
+	return
+}
+
+// PopMany executes the blocking BLMPOP command returning up to count elements from the first non empty list
+func (c *Conn) PopMany(timeout time.Duration, from ListSide, count int64, keys ...string) (key string, values []string, err error) {
+	return c.PopManyContext(context.Background(), timeout, from, count, keys...)
+}
+
+// PopManyContext executes the blocking BLMPOP command honoring the context deadline and cancellation
+func (c *Conn) PopManyContext(ctx context.Context, timeout time.Duration, from ListSide, count int64, keys ...string) (key string, values []string, err error) {
+	p := BlankPipeline(c.db)
+	defer ReleasePipeline(p)
+	p.BLMPop(c.blockTimeout(timeout), from, count, keys...)
+	rep := BlankReply()
+	defer ReleaseReply(rep)
+	if err = c.DoContext(ctx, p, rep); err != nil {
+		return
+	}
+	value := rep.Value().Get(0)
+	if err = value.Err(); err != nil {
+		return
+	}
+	if value.IsNull() {
+		err = new(TimeoutError)
+		return
+	}
+	key = string(value.Get(0).Bytes())
+	value.Get(1).ForEach(func(v resp.Value) {
+		values = append(values, string(v.Bytes()))
+	})
+	return
+}
+
+// PopManyZ executes the blocking BZMPOP command returning up to count members
+// with the lowest or highest scores from the first non empty sorted set
+func (c *Conn) PopManyZ(timeout time.Duration, max bool, count int64, keys ...string) (key string, members []ZMember, err error) {
+	return c.PopManyZContext(context.Background(), timeout, max, count, keys...)
+}
+
+// PopManyZContext executes the blocking BZMPOP command honoring the context deadline and cancellation
+func (c *Conn) PopManyZContext(ctx context.Context, timeout time.Duration, max bool, count int64, keys ...string) (key string, members []ZMember, err error) {
+	p := BlankPipeline(c.db)
+	defer ReleasePipeline(p)
+	p.BZMPop(c.blockTimeout(timeout), max, count, keys...)
+	rep := BlankReply()
+	defer ReleaseReply(rep)
+	if err = c.DoContext(ctx, p, rep); err != nil {
+		return
+	}
+	value := rep.Value().Get(0)
+	if err = value.Err(); err != nil {
+		return
+	}
+	if value.IsNull() {
+		err = new(TimeoutError)
+		return
+	}
+	key = string(value.Get(0).Bytes())
+	value.Get(1).ForEach(func(v resp.Value) {
+		score, _ := v.Get(1).Float()
+		members = append(members, Z(score, string(v.Get(0).Bytes())))
+	})
+	return
+}
+
+// ReadStreams executes XREAD.
+//
+// If options.Block is set the read deadline is extended for the block duration.
+// A timeout returns no streams and no error.
+func (c *Conn) ReadStreams(ctx context.Context, options XRead, streams ...XStream) ([]XStreamEntries, error) {
+	p := BlankPipeline(c.db)
+	defer ReleasePipeline(p)
+	p.XRead(options, streams...)
+	return c.xread(ctx, p)
+}
+
+// ReadGroup executes XREADGROUP.
+//
+// If options.Block is set the read deadline is extended for the block duration.
+// A timeout returns no streams and no error.
+func (c *Conn) ReadGroup(ctx context.Context, group, consumer string, options XReadGroup, streams ...XStream) ([]XStreamEntries, error) {
+	p := BlankPipeline(c.db)
+	defer ReleasePipeline(p)
+	p.XReadGroup(group, consumer, options, streams...)
+	return c.xread(ctx, p)
+}
+
+func (c *Conn) xread(ctx context.Context, p *Pipeline) ([]XStreamEntries, error) {
+	rep := BlankReply()
+	defer ReleaseReply(rep)
+	if err := c.DoContext(ctx, p, rep); err != nil {
+		return nil, err
+	}
+	return ParseXRead(nil, rep.Value().Get(0))
+}
+
+// blockTimeout rounds up a timeout to whole seconds unless the server is known to support fractional timeouts.
+//
+// The server version is only known if the connection was opened with HELLO.
+func (c *Conn) blockTimeout(timeout time.Duration) time.Duration {
+	if timeout <= 0 || timeout%time.Second == 0 {
+		return timeout
+	}
+	// Redis 6.0 accepts timeouts as floating point seconds
+	major := c.info.Version
+	if i := strings.IndexByte(major, '.'); i != -1 {
+		major = major[:i]
+	}
+	if n, err := strconv.Atoi(major); err == nil && n >= 6 {
+		return timeout
+	}
+	return timeout.Truncate(time.Second) + time.Second
+}
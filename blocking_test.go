@@ -0,0 +1,116 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+func TestConn_PopBlocking(t *testing.T) {
+	var last []string
+	s := &fakeServer{
+		handle: func(args []string, w *resp.Buffer) {
+			last = append(last[:0], args...)
+			switch args[0] {
+			case "BZPOPMAX":
+				time.Sleep(60 * time.Millisecond)
+				w.BulkStringArray("zset", "foo", "1.5")
+			case "BLMPOP":
+				w.Array(2)
+				w.BulkString("list")
+				w.BulkStringArray("a", "b")
+			default:
+				w.NullArray()
+			}
+		},
+	}
+	nc, _ := s.Dial("", 0)
+	conn := newConn(nc, ConnOptions{ReadTimeout: 20 * time.Millisecond})
+	defer conn.Close()
+	// Fractional timeouts are only sent to servers known to support them
+	conn.info.Version = "7.2.0"
+
+	// Reply arrives after the read timeout but within the block timeout
+	k, v, score, err := conn.PopMax(250*time.Millisecond, "zset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k != "zset" || v != "foo" || score != 1.5 {
+		t.Errorf("Invalid reply %q %q %f", k, v, score)
+	}
+	if last[0] != "BZPOPMAX" || last[2] != "0.25" {
+		t.Errorf("Invalid command %v", last)
+	}
+
+	key, values, err := conn.PopMany(2*time.Second, Right, 2, "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "list" || len(values) != 2 || values[1] != "b" {
+		t.Errorf("Invalid reply %q %v", key, values)
+	}
+	if want := []string{"BLMPOP", "2", "1", "list", "RIGHT", "COUNT", "2"}; !equalStrings(last, want) {
+		t.Errorf("Invalid command %v", last)
+	}
+
+	if _, _, err := conn.PopLeft(time.Second, "list"); err == nil {
+		t.Errorf("Expected timeout error")
+	} else if _, ok := err.(*TimeoutError); !ok {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestConn_PopBlockingCancel(t *testing.T) {
+	s := &fakeServer{
+		handle: func(args []string, w *resp.Buffer) {
+			time.Sleep(time.Second)
+		},
+	}
+	nc, _ := s.Dial("", 0)
+	conn := newConn(nc, ConnOptions{})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, _, err := conn.PopLeftContext(ctx, 0, "list"); err != context.Canceled {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestBlockTimeout(t *testing.T) {
+	p := BlankPipeline(0)
+	defer ReleasePipeline(p)
+	p.BLPop(1500*time.Millisecond, "foo")
+	p.XRead(XRead{Block: 2 * time.Second}, XS("bar", "$"))
+	if d := p.Block(); d != 2*time.Second {
+		t.Errorf("Invalid block %s", d)
+	}
+	p.BRPop(0, "foo")
+	if d := p.Block(); d >= 0 {
+		t.Errorf("Invalid block %s", d)
+	}
+	conn := Conn{info: ServerInfo{Version: "5.0.7"}}
+	if d := conn.blockTimeout(1500 * time.Millisecond); d != 2*time.Second {
+		t.Errorf("Invalid timeout for old server %s", d)
+	}
+	conn.info.Version = ""
+	if d := conn.blockTimeout(1500 * time.Millisecond); d != 2*time.Second {
+		t.Errorf("Invalid timeout for unknown server %s", d)
+	}
+	conn.info.Version = "7.2.4"
+	if d := conn.blockTimeout(1500 * time.Millisecond); d != 1500*time.Millisecond {
+		t.Errorf("Invalid timeout for new server %s", d)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
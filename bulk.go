@@ -0,0 +1,91 @@
+package redis
+
+import (
+	"context"
+	"io"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+// ErrNull is returned when a copied reply is null
+const ErrNull = Err("Null reply")
+
+// CopyTo executes a pipeline copying the reply of its last command to w.
+//
+// The reply must be a bulk string and is copied straight from the connection
+// without buffering it. The replies of all other commands are discarded.
+// If the reply is null it returns ErrNull.
+func (c *Conn) CopyTo(w io.Writer, pipeline *Pipeline) (n int64, err error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.options.WriteOnly {
+		return 0, errConnWriteOnly
+	}
+	if pipeline.Len() <= 0 {
+		return 0, ErrNull
+	}
+	if pipeline.scripts > 0 {
+		if err := c.loadScripts(pipeline); err != nil {
+			return 0, err
+		}
+	}
+	if c.block = pipeline.block; c.block != 0 {
+		defer func() { c.block = 0 }()
+	}
+	if err = c.writePipeline(pipeline); err != nil {
+		return 0, c.closeWithError(err)
+	}
+	if err = resp.DiscardN(c.r, int64(pipeline.n-1)); err != nil {
+		return 0, c.closeWithError(err)
+	}
+	if typ, e := c.r.Peek(1); e == nil && (typ[0] == resp.Error || typ[0] == resp.BlobError) {
+		// Error replies are read whole leaving the connection usable
+		reply := BlankReply()
+		defer ReleaseReply(reply)
+		v, err := reply.ReadFrom(c.r)
+		if err != nil {
+			return 0, c.closeWithError(err)
+		}
+		return 0, v.Err()
+	}
+	n, err = resp.CopyBulkString(w, c.r)
+	if err != nil {
+		// Write, protocol and I/O errors leave the connection out of sync
+		return n, c.closeWithError(err)
+	}
+	if n == -1 {
+		return 0, ErrNull
+	}
+	return n, nil
+}
+
+// GetTo copies the value of a key to w.
+//
+// If the key does not exist it returns ErrNull.
+func (c *Conn) GetTo(w io.Writer, key string) (int64, error) {
+	p := BlankPipeline(c.db)
+	defer ReleasePipeline(p)
+	p.Get(key)
+	return c.CopyTo(w, p)
+}
+
+// GetTo copies the value of a key to w using a pooled connection.
+//
+// If the key does not exist it returns ErrNull.
+func (pool *Pool) GetTo(ctx context.Context, w io.Writer, key string) (int64, error) {
+	conn, err := pool.GetContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer pool.Put(conn)
+	p := pool.Pipeline()
+	defer ReleasePipeline(p)
+	p.Get(key)
+	var n int64
+	err = conn.withContext(ctx, func() (err error) {
+		n, err = conn.CopyTo(w, p)
+		return
+	})
+	return n, err
+}
@@ -0,0 +1,167 @@
+package redis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestConn_GetTo(t *testing.T) {
+	values := map[string]string{}
+	s := &fakeServer{
+		handle: func(args []string, w *resp.Buffer) {
+			switch args[0] {
+			case "SET":
+				values[args[1]] = args[2]
+				w.SimpleString("OK")
+			case "GET":
+				switch args[1] {
+				case "list":
+					w.Error("WRONGTYPE Operation against a key holding the wrong kind of value")
+					return
+				case "count":
+					w.Int(1)
+					return
+				}
+				if v, ok := values[args[1]]; ok {
+					w.BulkString(v)
+				} else {
+					w.NullString()
+				}
+			default:
+				w.SimpleString("OK")
+			}
+		},
+	}
+	pool := Pool{Dial: s.Dial}
+	defer pool.Close()
+	conn, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Put(conn)
+
+	blob := strings.Repeat("0123456789", 10000)
+	p := BlankPipeline(0)
+	defer ReleasePipeline(p)
+	p.Set("foo", resp.Reader(strings.NewReader(blob), int64(len(blob))), 0)
+	r := BlankReply()
+	defer ReleaseReply(r)
+	if err := conn.Do(p, r); err != nil {
+		t.Fatal(err)
+	}
+	if values["foo"] != blob {
+		t.Fatalf("Invalid value size %d", len(values["foo"]))
+	}
+
+	w := new(bytes.Buffer)
+	n, err := conn.GetTo(w, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(blob)) || w.String() != blob {
+		t.Errorf("Invalid copy %d", n)
+	}
+	if _, err := conn.GetTo(w, "bar"); err != ErrNull {
+		t.Errorf("Invalid error %v", err)
+	}
+	w.Reset()
+	if _, err := pool.GetTo(context.Background(), w, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if w.String() != blob {
+		t.Errorf("Invalid pool copy %d", w.Len())
+	}
+	// Error replies leave the connection usable
+	if _, err := conn.GetTo(w, "list"); err == nil || !strings.HasPrefix(err.Error(), "WRONGTYPE") {
+		t.Errorf("Invalid error %v", err)
+	}
+	w.Reset()
+	if _, err := conn.GetTo(w, "foo"); err != nil || w.String() != blob {
+		t.Errorf("Invalid copy after error reply %v", err)
+	}
+	// A failed writer leaves the value in the connection
+	if _, err := conn.GetTo(failWriter{}, "foo"); err == nil || err.Error() != "write failed" {
+		t.Errorf("Invalid error %v", err)
+	}
+	if err := conn.Do(p, r); err == nil {
+		t.Error("Connection not closed")
+	}
+
+	// Other errors close the connection
+	conn2, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Put(conn2)
+	if _, err := conn2.GetTo(w, "count"); err == nil {
+		t.Error("Expected an error")
+	}
+	if _, err := conn2.GetTo(w, "foo"); err == nil {
+		t.Error("Connection not closed")
+	}
+}
+
+func TestConn_GetToDB(t *testing.T) {
+	var (
+		db    string
+		cache = map[string]bool{}
+	)
+	s := &fakeServer{
+		handle: func(args []string, w *resp.Buffer) {
+			switch args[0] {
+			case "SELECT":
+				db = args[1]
+				w.SimpleString("OK")
+			case "GET":
+				w.BulkString(db + ":" + args[1])
+			case "SCRIPT":
+				sum := NewScript(0, args[2]).SHA1()
+				cache[sum] = true
+				w.BulkString(sum)
+			case "EVALSHA":
+				if !cache[args[1]] {
+					w.Error("NOSCRIPT No matching script. Please use EVAL.")
+					return
+				}
+				w.BulkString(args[3])
+			}
+		},
+	}
+	pool := Pool{Dial: s.Dial, DB: 2}
+	defer pool.Close()
+	conn, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Put(conn)
+	w := new(bytes.Buffer)
+	if _, err := conn.GetTo(w, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if w.String() != "2:foo" {
+		t.Errorf("Invalid value %q", w.String())
+	}
+
+	// Scripts are loaded before copying
+	w.Reset()
+	p := pool.Pipeline()
+	defer ReleasePipeline(p)
+	p.RunScript(NewScript(1, "return KEYS[1]"), resp.Key("bar"))
+	if _, err := conn.CopyTo(w, p); err != nil {
+		t.Fatal(err)
+	}
+	if w.String() != "bar" {
+		t.Errorf("Invalid value %q", w.String())
+	}
+}
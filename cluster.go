@@ -0,0 +1,461 @@
+package redis
+
+import (
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+// ClusterSlots is the number of hash slots in a Redis Cluster
+const ClusterSlots = 16384
+
+// Cluster is a Redis Cluster client.
+//
+// It keeps a Pool for each master node and routes each command
+// by the hash slot of its first key argument.
+type Cluster struct {
+	noCopy
+
+	// Addresses are the seed nodes used to load the cluster topology
+	Addresses []string
+	// NewPool creates a pool for a node address
+	NewPool func(address string) *Pool
+	// MaxRedirects is the maximum number of MOVED or ASK redirections followed for a command (default 5)
+	MaxRedirects int
+
+	mu         sync.RWMutex
+	state      *clusterState
+	pools      map[string]*Pool
+	closed     bool
+	refreshing int32
+}
+
+type clusterState struct {
+	addrs []string
+	slots [ClusterSlots]int16 // index of the master address of each slot or -1
+}
+
+// ErrClusterDown occurs when no node serves a hash slot
+const ErrClusterDown = Err("Cluster down")
+
+const defaultMaxRedirects = 5
+
+// HashSlot returns the cluster hash slot of a key.
+//
+// If the key contains a hash tag like {user:1} only the tag is hashed.
+func HashSlot(key string) int {
+	return int(crc16(hashTag(key)) % ClusterSlots)
+}
+
+// hashTag returns the part of the key between the first { and the following }
+// or the whole key if there is no non empty hash tag
+func hashTag(key string) string {
+	if start := strings.IndexByte(key, '{'); start != -1 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+	return key
+}
+
+// Do executes a pipeline splitting commands to the nodes serving their keys.
+//
+// Replies are put back in the original command order.
+// Commands without keys are sent to a random node.
+// Pipelines with MULTI/EXEC are rejected; run transactions on the Pool of the node serving their keys.
+func (c *Cluster) Do(p *Pipeline, r *resp.Reply) error {
+	state, err := c.loadState()
+	if err != nil {
+		return err
+	}
+	batches, err := splitPipeline(p, func(cmd *command) (*Pool, error) {
+		return c.route(state, cmd)
+	})
+	if err != nil {
+		return err
+	}
+	defer releaseBatches(batches)
+	doBatches(batches)
+	values := make([]resp.Value, p.Len())
+	if err := collectBatches(values, batches); err != nil {
+		return err
+	}
+	var redirected []*resp.Reply
+	defer func() {
+		for _, r := range redirected {
+			ReleaseReply(r)
+		}
+	}()
+	for i, v := range values {
+		if !isRedirect(v) {
+			continue
+		}
+		rep := BlankReply()
+		redirected = append(redirected, rep)
+		values[i], err = c.redirect(p, p.offset+i, v, rep)
+		if err != nil {
+			return err
+		}
+	}
+	return mergeReplies(r, values)
+}
+
+// route returns the pool for the node serving the key of a command
+func (c *Cluster) route(state *clusterState, cmd *command) (*Pool, error) {
+	if !cmd.hasKey {
+		if len(state.addrs) == 0 {
+			return nil, ErrClusterDown
+		}
+		return c.pool(state.addrs[rand.Intn(len(state.addrs))])
+	}
+	slot := HashSlot(cmd.key)
+	if i := state.slots[slot]; 0 <= i && int(i) < len(state.addrs) {
+		return c.pool(state.addrs[i])
+	}
+	return nil, ErrClusterDown
+}
+
+func isRedirect(v resp.Value) bool {
+	if err := v.Err(); err != nil {
+		msg := err.Error()
+		return strings.HasPrefix(msg, "MOVED ") || strings.HasPrefix(msg, "ASK ")
+	}
+	return false
+}
+
+// redirect follows MOVED and ASK redirections for the i-th command of a pipeline
+func (c *Cluster) redirect(src *Pipeline, i int, v resp.Value, r *resp.Reply) (resp.Value, error) {
+	max := c.MaxRedirects
+	if max <= 0 {
+		max = defaultMaxRedirects
+	}
+	p := BlankPipeline(-1)
+	defer ReleasePipeline(p)
+	for n := 0; n < max && isRedirect(v); n++ {
+		// MOVED 3999 127.0.0.1:6381
+		fields := strings.Fields(v.Err().Error())
+		if len(fields) != 3 {
+			return v, nil
+		}
+		ask := fields[0] == "ASK"
+		if !ask {
+			c.refresh()
+		}
+		pool, err := c.pool(fields[2])
+		if err != nil {
+			return v, err
+		}
+		p.Reset()
+		if ask {
+			p.Asking()
+		}
+		p.appendCommand(src, i)
+		r.Reset()
+		if err := pool.Do(p, r); err != nil {
+			return v, err
+		}
+		v = r.Value().Get(p.Len() - 1)
+	}
+	return v, nil
+}
+
+// pool returns the pool for a node address creating it if needed
+func (c *Cluster) pool(addr string) (*Pool, error) {
+	c.mu.RLock()
+	pool, closed := c.pools[addr], c.closed
+	c.mu.RUnlock()
+	if closed {
+		return nil, errPoolClosed
+	}
+	if pool != nil {
+		return pool, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, errPoolClosed
+	}
+	if pool = c.pools[addr]; pool != nil {
+		return pool, nil
+	}
+	if c.NewPool != nil {
+		pool = c.NewPool(addr)
+	} else {
+		pool = &Pool{Address: addr}
+	}
+	if c.pools == nil {
+		c.pools = make(map[string]*Pool)
+	}
+	c.pools[addr] = pool
+	return pool, nil
+}
+
+func (c *Cluster) loadState() (*clusterState, error) {
+	c.mu.RLock()
+	state := c.state
+	c.mu.RUnlock()
+	if state != nil {
+		return state, nil
+	}
+	if err := c.Refresh(); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	state = c.state
+	c.mu.RUnlock()
+	return state, nil
+}
+
+// refresh reloads the topology in the background
+func (c *Cluster) refresh() {
+	if atomic.CompareAndSwapInt32(&c.refreshing, 0, 1) {
+		go func() {
+			defer atomic.StoreInt32(&c.refreshing, 0)
+			c.Refresh()
+		}()
+	}
+}
+
+// Refresh reloads the cluster topology from any known node
+func (c *Cluster) Refresh() (err error) {
+	addrs := c.Addresses
+	c.mu.RLock()
+	if c.state != nil {
+		addrs = append(append([]string(nil), c.state.addrs...), addrs...)
+	}
+	c.mu.RUnlock()
+	if len(addrs) == 0 {
+		return ErrClusterDown
+	}
+	err = ErrClusterDown
+	for _, addr := range addrs {
+		var (
+			pool  *Pool
+			state *clusterState
+		)
+		pool, err = c.pool(addr)
+		if err != nil {
+			return
+		}
+		state, err = loadClusterState(pool)
+		if err == nil {
+			c.setState(state)
+			return nil
+		}
+	}
+	return
+}
+
+func (c *Cluster) setState(state *clusterState) {
+	var stale []*Pool
+	c.mu.Lock()
+	c.state = state
+	for addr, pool := range c.pools {
+		if !containsString(state.addrs, addr) && !containsString(c.Addresses, addr) {
+			delete(c.pools, addr)
+			stale = append(stale, pool)
+		}
+	}
+	c.mu.Unlock()
+	for _, pool := range stale {
+		pool.Close()
+	}
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Close closes all node pools
+func (c *Cluster) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errPoolClosed
+	}
+	c.closed = true
+	for addr, pool := range c.pools {
+		pool.Close()
+		delete(c.pools, addr)
+	}
+	return nil
+}
+
+// loadClusterState loads the slot map with CLUSTER SLOTS falling back to CLUSTER SHARDS
+func loadClusterState(pool *Pool) (*clusterState, error) {
+	p := BlankPipeline(-1)
+	defer ReleasePipeline(p)
+	p.ClusterSlots()
+	r := BlankReply()
+	defer ReleaseReply(r)
+	if err := pool.Do(p, r); err != nil {
+		return nil, err
+	}
+	v := r.Value().Get(0)
+	if v.Err() == nil {
+		return parseClusterSlots(v)
+	}
+	p.Reset()
+	p.ClusterShards()
+	r.Reset()
+	if err := pool.Do(p, r); err != nil {
+		return nil, err
+	}
+	return parseClusterShards(r.Value().Get(0))
+}
+
+func newClusterState() *clusterState {
+	state := clusterState{}
+	for i := range state.slots {
+		state.slots[i] = -1
+	}
+	return &state
+}
+
+func (s *clusterState) assign(start, end int64, addr string) error {
+	if start < 0 || end < start || end >= ClusterSlots {
+		return errInvalidClusterReply
+	}
+	i := -1
+	for j, a := range s.addrs {
+		if a == addr {
+			i = j
+			break
+		}
+	}
+	if i == -1 {
+		i = len(s.addrs)
+		s.addrs = append(s.addrs, addr)
+	}
+	for slot := start; slot <= end; slot++ {
+		s.slots[slot] = int16(i)
+	}
+	return nil
+}
+
+const errInvalidClusterReply = Err("Invalid cluster topology reply")
+
+// parseClusterSlots parses a CLUSTER SLOTS reply
+func parseClusterSlots(v resp.Value) (*clusterState, error) {
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	state := newClusterState()
+	for i := 0; i < v.Len(); i++ {
+		// start, end, [ip, port, id], replicas...
+		r := v.Get(i)
+		start, ok1 := r.Get(0).Int()
+		end, ok2 := r.Get(1).Int()
+		master := r.Get(2)
+		port, ok3 := master.Get(1).Int()
+		if !(ok1 && ok2 && ok3) {
+			return nil, errInvalidClusterReply
+		}
+		addr := net.JoinHostPort(string(master.Get(0).Bytes()), strconv.FormatInt(port, 10))
+		if err := state.assign(start, end, addr); err != nil {
+			return nil, err
+		}
+	}
+	if len(state.addrs) == 0 {
+		return nil, ErrClusterDown
+	}
+	return state, nil
+}
+
+// parseClusterShards parses a CLUSTER SHARDS reply
+func parseClusterShards(v resp.Value) (*clusterState, error) {
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	state := newClusterState()
+	var err error
+	v.ForEach(func(shard resp.Value) {
+		if err != nil {
+			return
+		}
+		var (
+			slots resp.Value
+			addr  string
+		)
+		shard.ForEachKV(func(k []byte, v resp.Value) {
+			switch string(k) {
+			case "slots":
+				slots = v
+			case "nodes":
+				v.ForEach(func(node resp.Value) {
+					var host, role, port string
+					node.ForEachKV(func(k []byte, v resp.Value) {
+						switch string(k) {
+						case "ip":
+							if host == "" {
+								host = string(v.Bytes())
+							}
+						case "endpoint":
+							if s := string(v.Bytes()); s != "" && s != "?" {
+								host = s
+							}
+						case "port", "tls-port":
+							if n, ok := v.Int(); ok && port == "" {
+								port = strconv.FormatInt(n, 10)
+							}
+						case "role":
+							role = string(v.Bytes())
+						}
+					})
+					if role == "master" && addr == "" {
+						addr = net.JoinHostPort(host, port)
+					}
+				})
+			}
+		})
+		if addr == "" {
+			return
+		}
+		for i := 0; i+1 < slots.Len() && err == nil; i += 2 {
+			start, _ := slots.Get(i).Int()
+			end, _ := slots.Get(i + 1).Int()
+			err = state.assign(start, end, addr)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(state.addrs) == 0 {
+		return nil, ErrClusterDown
+	}
+	return state, nil
+}
+
+// crc16 implements the CRC16-CCITT (XMODEM) checksum used for cluster hash slots
+func crc16(key string) uint16 {
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^key[i]]
+	}
+	return crc
+}
+
+var crc16Table = func() (table [256]uint16) {
+	for i := range table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return
+}()
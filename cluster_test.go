@@ -0,0 +1,138 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+func TestHashSlot(t *testing.T) {
+	if crc := crc16("123456789"); crc != 0x31C3 {
+		t.Errorf("Invalid crc16 %x", crc)
+	}
+	for key, slot := range map[string]int{
+		"foo":                  12182,
+		"{user1000}.following": 3443,
+		"{user1000}.followers": 3443,
+		"foo{}{bar}":           8363,
+	} {
+		if s := HashSlot(key); s != slot {
+			t.Errorf("Invalid slot for %q: %d != %d", key, s, slot)
+		}
+	}
+}
+
+func TestParseClusterSlots(t *testing.T) {
+	b := resp.Buffer{}
+	b.Array(2)
+	b.Array(3)
+	b.Int(0)
+	b.Int(5460)
+	b.Array(3)
+	b.BulkString("127.0.0.1")
+	b.Int(30001)
+	b.BulkString("09dbe9720cda62f7865eabc5fd8857c5d2678366")
+	b.Array(4)
+	b.Int(5461)
+	b.Int(16383)
+	b.Array(3)
+	b.BulkString("127.0.0.1")
+	b.Int(30002)
+	b.BulkString("c9d93d9f2c0c524ff34cc11838c2003d8c29e013")
+	b.Array(3)
+	b.BulkString("127.0.0.1")
+	b.Int(30004)
+	b.BulkString("e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca")
+	v, err := resp.ParseValue(b.B)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := parseClusterSlots(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.addrs) != 2 {
+		t.Fatalf("Invalid nodes %v", state.addrs)
+	}
+	if addr := state.addrs[state.slots[HashSlot("foo")]]; addr != "127.0.0.1:30002" {
+		t.Errorf("Invalid node for foo: %s", addr)
+	}
+	if addr := state.addrs[state.slots[0]]; addr != "127.0.0.1:30001" {
+		t.Errorf("Invalid node for slot 0: %s", addr)
+	}
+}
+
+func TestCluster_Do(t *testing.T) {
+	nodes := map[string]*fakeServer{}
+	slots := func(w *resp.Buffer) {
+		w.Array(2)
+		for i, addr := range []string{"a:1", "b:1"} {
+			w.Array(3)
+			w.Int(int64(i * 8192))
+			w.Int(int64(i*8192 + 8191))
+			w.Array(2)
+			w.BulkString(addr[:1])
+			w.Int(1)
+		}
+	}
+	for _, name := range []string{"a", "b"} {
+		name := name
+		nodes[name+":1"] = &fakeServer{
+			handle: func(args []string, w *resp.Buffer) {
+				switch args[0] {
+				case "CLUSTER":
+					slots(w)
+				case "GET":
+					if args[1] == "moved" && name == "a" {
+						w.Error("MOVED 1234 b:1")
+						return
+					}
+					w.BulkString(name + ":" + args[1])
+				default:
+					w.Error("ERR unknown command")
+				}
+			},
+		}
+	}
+	c := Cluster{
+		Addresses: []string{"a:1"},
+		NewPool: func(addr string) *Pool {
+			return &Pool{Address: addr, Dial: nodes[addr].Dial}
+		},
+	}
+	defer c.Close()
+	p := BlankPipeline(0)
+	defer ReleasePipeline(p)
+	p.Get("foo")
+	p.Get("bar")
+	p.Get("moved")
+	p.Get("baz")
+	r := BlankReply()
+	defer ReleaseReply(r)
+	if err := c.Do(p, r); err != nil {
+		t.Fatal(err)
+	}
+	v := r.Value()
+	if v.Len() != 4 {
+		t.Fatalf("Invalid reply size %d", v.Len())
+	}
+	for i, expect := range []string{"b:foo", "a:bar", "b:moved", "a:baz"} {
+		if s := string(v.Get(i).Bytes()); s != expect {
+			t.Errorf("Invalid reply %d %q != %q", i, s, expect)
+		}
+	}
+}
+
+func TestSplitPipeline_Transaction(t *testing.T) {
+	p := BlankPipeline(0)
+	defer ReleasePipeline(p)
+	p.Multi()
+	p.Set("foo", resp.String("bar"), 0)
+	p.Exec()
+	_, err := splitPipeline(p, func(cmd *command) (*Pool, error) {
+		return nil, nil
+	})
+	if err != errSplitTransaction {
+		t.Errorf("Invalid error %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package redis
+
+import "strings"
+
+// cmdFlags describes properties of a Redis command
+type cmdFlags uint8
+
+const (
+	// cmdReadOnly commands do not modify data and can be served by replicas
+	cmdReadOnly cmdFlags = 1 << iota
+	// cmdIdempotent commands have the same effect when executed more than once
+	cmdIdempotent
+)
+
+// commandFlags are the flags of known commands.
+//
+// Commands not listed here are assumed to modify data and not be idempotent.
+// Read-only commands are always idempotent.
+var commandFlags = map[string]cmdFlags{
+	// Idempotent writes.
+	// Commands whose effect depends on the current state like EXPIRE with a relative TTL,
+	// LTRIM with offsets or ZADD INCR are not listed. SET with EX or PX restarts the TTL on retry.
+	"DEL":              cmdIdempotent,
+	"EXPIREAT":         cmdIdempotent,
+	"FLUSHALL":         cmdIdempotent,
+	"FLUSHDB":          cmdIdempotent,
+	"HDEL":             cmdIdempotent,
+	"HMSET":            cmdIdempotent,
+	"HSET":             cmdIdempotent,
+	"LSET":             cmdIdempotent,
+	"MSET":             cmdIdempotent,
+	"PERSIST":          cmdIdempotent,
+	"PEXPIREAT":        cmdIdempotent,
+	"PFADD":            cmdIdempotent,
+	"PFMERGE":          cmdIdempotent,
+	"SADD":             cmdIdempotent,
+	"SET":              cmdIdempotent,
+	"SETBIT":           cmdIdempotent,
+	"SETRANGE":         cmdIdempotent,
+	"SREM":             cmdIdempotent,
+	"UNLINK":           cmdIdempotent,
+	"XACK":             cmdIdempotent,
+	"XDEL":             cmdIdempotent,
+	"ZREM":             cmdIdempotent,
+	"ZREMRANGEBYLEX":   cmdIdempotent,
+	"ZREMRANGEBYSCORE": cmdIdempotent,
+	// Connection state
+	"AUTH":   cmdIdempotent,
+	"HELLO":  cmdIdempotent,
+	"SELECT": cmdIdempotent,
+
+	// Keys
+	"DUMP":        cmdReadOnly,
+	"EXISTS":      cmdReadOnly,
+	"KEYS":        cmdReadOnly,
+	"PTTL":        cmdReadOnly,
+	"RANDOMKEY":   cmdReadOnly,
+	"SCAN":        cmdReadOnly,
+	"TOUCH":       cmdReadOnly,
+	"TTL":         cmdReadOnly,
+	"TYPE":        cmdReadOnly,
+	"EXPIRETIME":  cmdReadOnly,
+	"PEXPIRETIME": cmdReadOnly,
+	"OBJECT":      cmdReadOnly,
+	"SORT_RO":     cmdReadOnly,
+	// Strings
+	"BITCOUNT": cmdReadOnly,
+	"BITPOS":   cmdReadOnly,
+	"GET":      cmdReadOnly,
+	"GETBIT":   cmdReadOnly,
+	"GETRANGE": cmdReadOnly,
+	"MGET":     cmdReadOnly,
+	"STRLEN":   cmdReadOnly,
+	"LCS":      cmdReadOnly,
+	// Hashes
+	"HEXISTS":    cmdReadOnly,
+	"HGET":       cmdReadOnly,
+	"HGETALL":    cmdReadOnly,
+	"HKEYS":      cmdReadOnly,
+	"HLEN":       cmdReadOnly,
+	"HMGET":      cmdReadOnly,
+	"HRANDFIELD": cmdReadOnly,
+	"HSCAN":      cmdReadOnly,
+	"HSTRLEN":    cmdReadOnly,
+	"HVALS":      cmdReadOnly,
+	// Lists
+	"LINDEX": cmdReadOnly,
+	"LLEN":   cmdReadOnly,
+	"LPOS":   cmdReadOnly,
+	"LRANGE": cmdReadOnly,
+	// Sets
+	"SCARD":       cmdReadOnly,
+	"SDIFF":       cmdReadOnly,
+	"SINTER":      cmdReadOnly,
+	"SINTERCARD":  cmdReadOnly,
+	"SISMEMBER":   cmdReadOnly,
+	"SMEMBERS":    cmdReadOnly,
+	"SMISMEMBER":  cmdReadOnly,
+	"SRANDMEMBER": cmdReadOnly,
+	"SSCAN":       cmdReadOnly,
+	"SUNION":      cmdReadOnly,
+	// Sorted sets
+	"ZCARD":            cmdReadOnly,
+	"ZCOUNT":           cmdReadOnly,
+	"ZDIFF":            cmdReadOnly,
+	"ZINTER":           cmdReadOnly,
+	"ZINTERCARD":       cmdReadOnly,
+	"ZLEXCOUNT":        cmdReadOnly,
+	"ZMSCORE":          cmdReadOnly,
+	"ZRANDMEMBER":      cmdReadOnly,
+	"ZRANGE":           cmdReadOnly,
+	"ZRANGEBYLEX":      cmdReadOnly,
+	"ZRANGEBYSCORE":    cmdReadOnly,
+	"ZRANK":            cmdReadOnly,
+	"ZREVRANGE":        cmdReadOnly,
+	"ZREVRANGEBYLEX":   cmdReadOnly,
+	"ZREVRANGEBYSCORE": cmdReadOnly,
+	"ZREVRANK":         cmdReadOnly,
+	"ZSCAN":            cmdReadOnly,
+	"ZSCORE":           cmdReadOnly,
+	"ZUNION":           cmdReadOnly,
+	// HyperLogLog
+	"PFCOUNT": cmdReadOnly,
+	// Geo
+	"GEODIST":              cmdReadOnly,
+	"GEOHASH":              cmdReadOnly,
+	"GEOPOS":               cmdReadOnly,
+	"GEORADIUS_RO":         cmdReadOnly,
+	"GEORADIUSBYMEMBER_RO": cmdReadOnly,
+	"GEOSEARCH":            cmdReadOnly,
+	// Streams
+	"XINFO":     cmdReadOnly,
+	"XLEN":      cmdReadOnly,
+	"XPENDING":  cmdReadOnly,
+	"XRANGE":    cmdReadOnly,
+	"XREAD":     cmdReadOnly,
+	"XREVRANGE": cmdReadOnly,
+	// Scripting
+	"EVAL_RO":    cmdReadOnly,
+	"EVALSHA_RO": cmdReadOnly,
+	"FCALL_RO":   cmdReadOnly,
+	// Connection
+	"ECHO": cmdReadOnly,
+	"PING": cmdReadOnly,
+}
+
+// flagsOf returns the flags of a command
+func flagsOf(name string) cmdFlags {
+	if flags, ok := commandFlags[name]; ok {
+		return flags
+	}
+	return commandFlags[strings.ToUpper(name)]
+}
+
+// IsReadOnly checks if all commands in a pipeline are read-only.
+//
+// An empty pipeline is not read-only.
+func (p *Pipeline) IsReadOnly() bool {
+	if p.Len() == 0 {
+		return false
+	}
+	for i := p.offset; i < len(p.cmds); i++ {
+		if flagsOf(p.cmds[i].name)&cmdReadOnly == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// IsIdempotent checks if all commands in a pipeline can safely be executed more than once
+func (p *Pipeline) IsIdempotent() bool {
+	for i := p.offset; i < len(p.cmds); i++ {
+		if flagsOf(p.cmds[i].name)&(cmdReadOnly|cmdIdempotent) == 0 {
+			return false
+		}
+	}
+	return true
+}
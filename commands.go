@@ -10,26 +10,79 @@ import (
 
 // TODO: [commands] Cluster commands
 
+// Asking allows the next command to be executed on a node importing a slot after an ASK redirection
+func (p *Pipeline) Asking() {
+	p.do("ASKING")
+}
+
+// ClusterSlots returns the mapping of cluster slots to nodes
+func (p *Pipeline) ClusterSlots() {
+	p.do("CLUSTER", resp.String("SLOTS"))
+}
+
+// ClusterShards returns details about the shards of the cluster
+func (p *Pipeline) ClusterShards() {
+	p.do("CLUSTER", resp.String("SHARDS"))
+}
+
+// ReadOnly enables read queries to a cluster replica node
+func (p *Pipeline) ReadOnly() {
+	p.do("READONLY")
+}
+
 // Connection
 
 // Auth authenticates to the server
 func (p *Pipeline) Auth(password string) {
-	p.BulkStringArray("AUTH", password)
+	p.do("AUTH", resp.String(password))
+}
+
+// AuthUser authenticates to the server as an ACL user
+func (p *Pipeline) AuthUser(username, password string) {
+	if username == "" {
+		p.Auth(password)
+		return
+	}
+	p.do("AUTH", resp.String(username), resp.String(password))
+}
+
+// ClientSetName sets the current connection name
+func (p *Pipeline) ClientSetName(name string) {
+	p.do("CLIENT", resp.String("SETNAME"), resp.String(name))
+}
+
+// Hello switches protocol version and optionally authenticates and sets the connection name
+func (p *Pipeline) Hello(proto int64, username, password, clientName string) {
+	args := []resp.Arg{resp.Int(proto)}
+	if password != "" {
+		if username == "" {
+			username = "default"
+		}
+		args = append(args, resp.String("AUTH"), resp.String(username), resp.String(password))
+	}
+	if clientName != "" {
+		args = append(args, resp.String("SETNAME"), resp.String(clientName))
+	}
+	p.do("HELLO", args...)
 }
 
 // Echo exchos the given string
 func (p *Pipeline) Echo(message string) {
-	p.BulkStringArray("ECHO", message)
+	p.do("ECHO", resp.String(message))
 }
 
 // Ping pings the server
 func (p *Pipeline) Ping(message string) {
-	p.BulkStringArray("PING", message)
+	if message == "" {
+		p.do("PING")
+	} else {
+		p.do("PING", resp.String(message))
+	}
 }
 
 // Quit closes the connection
 func (p *Pipeline) Quit() {
-	p.BulkStringArray("QUIT")
+	p.do("QUIT")
 }
 
 // Select changes the selected database for the current connection
@@ -374,24 +427,93 @@ func (p *Pipeline) Scan(cur int64, match string, count int64) {
 
 // Lists
 
-func (p *Pipeline) BLPop(timeout time.Duration, keys ...string) {
-	p.Command("BLPOP", 1+len(keys))
-	for _, key := range keys {
-		p.Arg(resp.Key(key))
+// ListSide selects the head or the tail of a list
+type ListSide uint
+
+// ListSide enum
+const (
+	Left ListSide = iota
+	Right
+)
+
+func (side ListSide) String() string {
+	if side == Right {
+		return "RIGHT"
 	}
-	p.Arg(resp.Int(int64(timeout / time.Second)))
+	return "LEFT"
 }
 
+// blockTimeout encodes the timeout of a blocking command in seconds.
+// Fractional seconds are sent as a float and a timeout of zero or less blocks indefinitely.
+// Servers before 6.0 reject float timeouts, the blocking Conn helpers round them up for these servers.
+func blockTimeout(timeout time.Duration) resp.Arg {
+	switch {
+	case timeout <= 0:
+		return resp.Int(0)
+	case timeout%time.Second == 0:
+		return resp.Int(int64(timeout / time.Second))
+	default:
+		return resp.Float(timeout.Seconds())
+	}
+}
+
+// BLPop removes and gets the first element in a list or blocks until one is available
+//
+// Timeouts with fractional seconds require Redis 6.0, use Conn.PopLeft with older servers.
+func (p *Pipeline) BLPop(timeout time.Duration, keys ...string) {
+	p.bpop("BLPOP", timeout, keys)
+}
+
+// BRPop removes and gets the last element in a list or blocks until one is available
+//
+// Timeouts with fractional seconds require Redis 6.0, use Conn.PopRight with older servers.
 func (p *Pipeline) BRPop(timeout time.Duration, keys ...string) {
-	p.Command("BRPOP", 1+len(keys))
+	p.bpop("BRPOP", timeout, keys)
+}
+
+func (p *Pipeline) bpop(cmd string, timeout time.Duration, keys []string) {
+	p.Command(cmd, 1+len(keys))
 	for _, key := range keys {
 		p.Arg(resp.Key(key))
 	}
-	p.Arg(resp.Int(int64(timeout / time.Second)))
+	p.Arg(blockTimeout(timeout))
+	p.blocking(timeout)
 }
+
+// BRPopLPush pops an element from a list, pushes it to another list and returns it or blocks until one is available
+//
+// Timeouts with fractional seconds require Redis 6.0, use Conn.PopPush with older servers.
 func (p *Pipeline) BRPopLPush(src, dest string, timeout time.Duration) {
-	p.do("BRPOPLPUSH", resp.Key(src), resp.Key(dest), resp.Int(int64(timeout/time.Second)))
+	p.do("BRPOPLPUSH", resp.Key(src), resp.Key(dest), blockTimeout(timeout))
+	p.blocking(timeout)
+}
+
+// BLMove pops an element from a side of a list, pushes it to a side of another list and returns it
+// or blocks until one is available
+func (p *Pipeline) BLMove(src, dest string, from, to ListSide, timeout time.Duration) {
+	p.do("BLMOVE", resp.Key(src), resp.Key(dest), resp.String(from.String()), resp.String(to.String()), blockTimeout(timeout))
+	p.blocking(timeout)
+}
+
+// BLMPop pops up to count elements from a side of the first non empty list or blocks until one is available
+func (p *Pipeline) BLMPop(timeout time.Duration, from ListSide, count int64, keys ...string) {
+	numArgs := 3 + len(keys)
+	if count > 0 {
+		numArgs += 2
+	}
+	p.Command("BLMPOP", numArgs)
+	p.Arg(blockTimeout(timeout), resp.Int(int64(len(keys))))
+	for _, key := range keys {
+		p.Arg(resp.Key(key))
+	}
+	p.BulkString(from.String())
+	if count > 0 {
+		p.BulkString("COUNT")
+		p.Arg(resp.Int(count))
+	}
+	p.blocking(timeout)
 }
+
 func (p *Pipeline) LIndex(key string, index int64) {
 	p.do("LINDEX", resp.Key(key), resp.Int(index))
 }
@@ -443,7 +565,66 @@ func (p *Pipeline) RPushX(key string, value resp.Arg) {
 }
 
 // Pub/Sub
-// TODO: [commands] Pub/Sub commands
+
+// Publish posts a message to a channel
+func (p *Pipeline) Publish(channel string, message resp.Arg) {
+	p.do("PUBLISH", resp.String(channel), message)
+}
+
+// Subscribe listens for messages published to the given channels
+func (p *Pipeline) Subscribe(channels ...string) {
+	p.Command("SUBSCRIBE", len(channels))
+	for _, ch := range channels {
+		p.Arg(resp.String(ch))
+	}
+}
+
+// PSubscribe listens for messages published to channels matching the given patterns
+func (p *Pipeline) PSubscribe(patterns ...string) {
+	p.Command("PSUBSCRIBE", len(patterns))
+	for _, pattern := range patterns {
+		p.Arg(resp.String(pattern))
+	}
+}
+
+// Unsubscribe stops listening for messages posted to the given channels or all channels if none is given
+func (p *Pipeline) Unsubscribe(channels ...string) {
+	p.Command("UNSUBSCRIBE", len(channels))
+	for _, ch := range channels {
+		p.Arg(resp.String(ch))
+	}
+}
+
+// PUnsubscribe stops listening for messages posted to channels matching the given patterns or all patterns if none is given
+func (p *Pipeline) PUnsubscribe(patterns ...string) {
+	p.Command("PUNSUBSCRIBE", len(patterns))
+	for _, pattern := range patterns {
+		p.Arg(resp.String(pattern))
+	}
+}
+
+// PubSubChannels lists the currently active channels matching an optional pattern
+func (p *Pipeline) PubSubChannels(pattern string) {
+	if pattern == "" {
+		p.do("PUBSUB", resp.String("CHANNELS"))
+	} else {
+		p.do("PUBSUB", resp.String("CHANNELS"), resp.String(pattern))
+	}
+}
+
+// PubSubNumSub returns the number of subscribers for the given channels
+func (p *Pipeline) PubSubNumSub(channels ...string) {
+	p.Command("PUBSUB", 1+len(channels))
+	p.BulkString("NUMSUB")
+	for _, ch := range channels {
+		p.Arg(resp.String(ch))
+	}
+}
+
+// PubSubNumPat returns the number of subscriptions to patterns
+func (p *Pipeline) PubSubNumPat() {
+	p.do("PUBSUB", resp.String("NUMPAT"))
+}
 
 // Scripting
 
@@ -478,6 +659,89 @@ func splitKeysArgs(keysAndArgs []resp.Arg) (keys, args []resp.Arg) {
 	return keysAndArgs, nil
 }
 
+// FCall invokes a function loaded with FUNCTION LOAD
+func (p *Pipeline) FCall(function string, keysAndArgs ...resp.Arg) {
+	p.fcall("FCALL", function, keysAndArgs)
+}
+
+// FCallRO invokes a read-only function loaded with FUNCTION LOAD
+func (p *Pipeline) FCallRO(function string, keysAndArgs ...resp.Arg) {
+	p.fcall("FCALL_RO", function, keysAndArgs)
+}
+
+func (p *Pipeline) fcall(cmd, function string, keysAndArgs []resp.Arg) {
+	p.Command(cmd, len(keysAndArgs)+2)
+	p.BulkString(function)
+	keys, _ := splitKeysArgs(keysAndArgs)
+	p.Arg(resp.Int(int64(len(keys))))
+	p.Arg(keysAndArgs...)
+}
+
+// FunctionDelete deletes a library and all its functions
+func (p *Pipeline) FunctionDelete(library string) {
+	p.do("FUNCTION", resp.String("DELETE"), resp.String(library))
+}
+
+// FunctionDump returns a serialized payload of all loaded libraries
+func (p *Pipeline) FunctionDump() {
+	p.do("FUNCTION", resp.String("DUMP"))
+}
+
+// FunctionFlush deletes all libraries
+func (p *Pipeline) FunctionFlush(async bool) {
+	if async {
+		p.do("FUNCTION", resp.String("FLUSH"), resp.String("ASYNC"))
+	} else {
+		p.do("FUNCTION", resp.String("FLUSH"), resp.String("SYNC"))
+	}
+}
+
+// FunctionList returns information about the libraries matching an optional pattern
+func (p *Pipeline) FunctionList(pattern string, withCode bool) {
+	args := []resp.Arg{resp.String("LIST")}
+	if pattern != "" {
+		args = append(args, resp.String("LIBRARYNAME"), resp.String(pattern))
+	}
+	if withCode {
+		args = append(args, resp.String("WITHCODE"))
+	}
+	p.do("FUNCTION", args...)
+}
+
+// FunctionLoad loads a library, replacing an existing library with the same name if replace is set
+func (p *Pipeline) FunctionLoad(code string, replace bool) {
+	if replace {
+		p.do("FUNCTION", resp.String("LOAD"), resp.String("REPLACE"), resp.String(code))
+	} else {
+		p.do("FUNCTION", resp.String("LOAD"), resp.String(code))
+	}
+}
+
+// FunctionRestorePolicy determines how FUNCTION RESTORE handles existing libraries
+type FunctionRestorePolicy uint
+
+// FunctionRestorePolicy enum
+const (
+	// RestoreAppend fails if a restored library already exists (default)
+	RestoreAppend FunctionRestorePolicy = iota
+	// RestoreFlush deletes all existing libraries before restoring
+	RestoreFlush
+	// RestoreReplace replaces existing libraries with the same name
+	RestoreReplace
+)
+
+// FunctionRestore restores libraries from a payload returned by FUNCTION DUMP
+func (p *Pipeline) FunctionRestore(payload []byte, policy FunctionRestorePolicy) {
+	switch policy {
+	case RestoreFlush:
+		p.do("FUNCTION", resp.String("RESTORE"), resp.Raw(payload), resp.String("FLUSH"))
+	case RestoreReplace:
+		p.do("FUNCTION", resp.String("RESTORE"), resp.Raw(payload), resp.String("REPLACE"))
+	default:
+		p.do("FUNCTION", resp.String("RESTORE"), resp.Raw(payload), resp.String("APPEND"))
+	}
+}
+
 // ScriptExists checks existence of scripts in the script cache
 func (p *Pipeline) ScriptExists(sha1 ...string) {
 	p.Command("SCRIPT", 1+len(sha1))
@@ -516,6 +780,13 @@ func (p *Pipeline) ScriptLoad(script string) {
 	p.do("SCRIPT", resp.String("LOAD"), resp.String(script))
 }
 
+// Sentinel
+
+// SentinelGetMasterAddrByName returns the address of the master with the given name
+func (p *Pipeline) SentinelGetMasterAddrByName(name string) {
+	p.do("SENTINEL", resp.String("get-master-addr-by-name"), resp.String(name))
+}
+
 // Server
 // TODO: [commands] Server
 
@@ -732,6 +1003,46 @@ func (p *Pipeline) ZPopMax(key string, count int64) {
 	}
 }
 
+// BZPopMax removes and returns the member with the highest score from the first non empty sorted set
+// or blocks until one is available
+//
+// Timeouts with fractional seconds require Redis 6.0, use Conn.PopMax with older servers.
+func (p *Pipeline) BZPopMax(timeout time.Duration, keys ...string) {
+	p.bpop("BZPOPMAX", timeout, keys)
+}
+
+// BZPopMin removes and returns the member with the lowest score from the first non empty sorted set
+// or blocks until one is available
+//
+// Timeouts with fractional seconds require Redis 6.0, use Conn.PopMin with older servers.
+func (p *Pipeline) BZPopMin(timeout time.Duration, keys ...string) {
+	p.bpop("BZPOPMIN", timeout, keys)
+}
+
+// BZMPop removes and returns up to count members with the lowest or highest scores
+// from the first non empty sorted set or blocks until one is available
+func (p *Pipeline) BZMPop(timeout time.Duration, max bool, count int64, keys ...string) {
+	numArgs := 3 + len(keys)
+	if count > 0 {
+		numArgs += 2
+	}
+	p.Command("BZMPOP", numArgs)
+	p.Arg(blockTimeout(timeout), resp.Int(int64(len(keys))))
+	for _, key := range keys {
+		p.Arg(resp.Key(key))
+	}
+	if max {
+		p.BulkString("MAX")
+	} else {
+		p.BulkString("MIN")
+	}
+	if count > 0 {
+		p.BulkString("COUNT")
+		p.Arg(resp.Int(count))
+	}
+	p.blocking(timeout)
+}
+
 // ZPopMin removes and returns members with the lowest scores in a sorted set
 func (p *Pipeline) ZPopMin(key string, count int64) {
 	if count > 0 {
@@ -841,6 +1152,348 @@ func (p *Pipeline) ZScan(key string, cur int64, match string, count int64) {
 	}
 }
 
+// Streams
+
+// XStream is a stream key and an entry ID to read after
+type XStream struct {
+	Key string
+	ID  string
+}
+
+// XS creates a new XStream
+func XS(key, id string) XStream {
+	return XStream{Key: key, ID: id}
+}
+
+// XTrim options for trimming a stream
+type XTrim struct {
+	// MaxLen trims the stream to at most MaxLen entries if it is positive
+	MaxLen int64
+	// MaxLenZero sends MAXLEN 0 to remove all entries since a zero MaxLen means no MAXLEN
+	MaxLenZero bool
+	MinID      string
+	// Approx trims with ~ letting the server remove fewer entries for efficiency
+	Approx bool
+	// Limit caps the number of entries evicted by an approximate trim.
+	// It is only sent when Approx is set since the server rejects LIMIT for exact trimming.
+	Limit int64
+}
+
+func (t *XTrim) args(args []resp.Arg) []resp.Arg {
+	maxLen := t.MaxLen > 0 || t.MaxLenZero
+	switch {
+	case maxLen:
+		args = append(args, resp.String("MAXLEN"))
+	case t.MinID != "":
+		args = append(args, resp.String("MINID"))
+	default:
+		return args
+	}
+	if t.Approx {
+		args = append(args, resp.String("~"))
+	}
+	if maxLen {
+		args = append(args, resp.Int(t.MaxLen))
+	} else {
+		args = append(args, resp.String(t.MinID))
+	}
+	if t.Approx && t.Limit > 0 {
+		args = append(args, resp.String("LIMIT"), resp.Int(t.Limit))
+	}
+	return args
+}
+
+// XAdd options
+type XAdd struct {
+	ID         string // Defaults to "*"
+	NoMkStream bool
+	XTrim
+}
+
+// XAdd appends a new entry to a stream
+func (p *Pipeline) XAdd(key string, options XAdd, fields ...resp.KV) {
+	args := []resp.Arg{resp.Key(key)}
+	if options.NoMkStream {
+		args = append(args, resp.String("NOMKSTREAM"))
+	}
+	args = options.XTrim.args(args)
+	if options.ID == "" {
+		options.ID = "*"
+	}
+	args = append(args, resp.String(options.ID))
+	for i := range fields {
+		kv := &fields[i]
+		args = append(args, resp.String(kv.Key), kv.Arg)
+	}
+	p.do("XADD", args...)
+}
+
+// XTrim trims a stream
+func (p *Pipeline) XTrim(key string, options XTrim) {
+	args := options.args([]resp.Arg{resp.Key(key)})
+	p.do("XTRIM", args...)
+}
+
+// XDel removes the specified entries from a stream
+func (p *Pipeline) XDel(key string, ids ...string) {
+	p.Command("XDEL", 1+len(ids))
+	p.Arg(resp.Key(key))
+	for _, id := range ids {
+		p.Arg(resp.String(id))
+	}
+}
+
+// XLen returns the number of entries in a stream
+func (p *Pipeline) XLen(key string) {
+	p.do("XLEN", resp.Key(key))
+}
+
+// XRange returns a range of entries in a stream
+func (p *Pipeline) XRange(key, start, end string, count int64) {
+	p.xrange("XRANGE", key, start, end, count)
+}
+
+// XRevRange returns a range of entries in a stream in reverse order
+func (p *Pipeline) XRevRange(key, end, start string, count int64) {
+	p.xrange("XREVRANGE", key, end, start, count)
+}
+
+func (p *Pipeline) xrange(cmd, key, from, to string, count int64) {
+	if count > 0 {
+		p.do(cmd, resp.Key(key), resp.String(from), resp.String(to), resp.String("COUNT"), resp.Int(count))
+	} else {
+		p.do(cmd, resp.Key(key), resp.String(from), resp.String(to))
+	}
+}
+
+// XRead options
+type XRead struct {
+	Count int64
+	// Block blocks for the specified duration if no entries are available.
+	// A negative duration blocks indefinitely.
+	Block time.Duration
+}
+
+func (r *XRead) args(args []resp.Arg) []resp.Arg {
+	if r.Count > 0 {
+		args = append(args, resp.String("COUNT"), resp.Int(r.Count))
+	}
+	switch {
+	case r.Block > 0:
+		ms := int64(r.Block / time.Millisecond)
+		if ms == 0 {
+			ms = 1
+		}
+		args = append(args, resp.String("BLOCK"), resp.Int(ms))
+	case r.Block < 0:
+		args = append(args, resp.String("BLOCK"), resp.Int(0))
+	}
+	return args
+}
+
+// blocking marks the last command of the pipeline as blocking if Block is set
+func (r *XRead) blocking(p *Pipeline) {
+	if r.Block != 0 {
+		p.blocking(r.Block)
+	}
+}
+
+func xstreams(args []resp.Arg, streams []XStream) []resp.Arg {
+	args = append(args, resp.String("STREAMS"))
+	for i := range streams {
+		args = append(args, resp.Key(streams[i].Key))
+	}
+	for i := range streams {
+		args = append(args, resp.String(streams[i].ID))
+	}
+	return args
+}
+
+// XRead reads entries from one or more streams
+func (p *Pipeline) XRead(options XRead, streams ...XStream) {
+	args := options.args(nil)
+	args = xstreams(args, streams)
+	p.do("XREAD", args...)
+	options.blocking(p)
+}
+
+// XReadGroup options
+type XReadGroup struct {
+	XRead
+	NoAck bool
+}
+
+// XReadGroup reads entries from one or more streams as a consumer of a group.
+// Use ">" as ID to read entries never delivered to other consumers.
+func (p *Pipeline) XReadGroup(group, consumer string, options XReadGroup, streams ...XStream) {
+	args := []resp.Arg{resp.String("GROUP"), resp.String(group), resp.String(consumer)}
+	args = options.XRead.args(args)
+	if options.NoAck {
+		args = append(args, resp.String("NOACK"))
+	}
+	args = xstreams(args, streams)
+	p.do("XREADGROUP", args...)
+	options.XRead.blocking(p)
+}
+
+// XAck acknowledges the processing of stream entries by a group
+func (p *Pipeline) XAck(key, group string, ids ...string) {
+	p.Command("XACK", 2+len(ids))
+	p.Arg(resp.Key(key), resp.String(group))
+	for _, id := range ids {
+		p.Arg(resp.String(id))
+	}
+}
+
+// XClaim options
+type XClaim struct {
+	Idle       time.Duration
+	Time       time.Time
+	RetryCount int64
+	Force      bool
+	JustID     bool
+	LastID     string
+}
+
+// XClaim changes the ownership of pending entries to a consumer
+func (p *Pipeline) XClaim(key, group, consumer string, minIdle time.Duration, options XClaim, ids ...string) {
+	args := []resp.Arg{
+		resp.Key(key),
+		resp.String(group),
+		resp.String(consumer),
+		resp.Int(int64(minIdle / time.Millisecond)),
+	}
+	for _, id := range ids {
+		args = append(args, resp.String(id))
+	}
+	if options.Idle > 0 {
+		args = append(args, resp.String("IDLE"), resp.Int(int64(options.Idle/time.Millisecond)))
+	}
+	if !options.Time.IsZero() {
+		ms := options.Time.UnixNano() / int64(time.Millisecond)
+		args = append(args, resp.String("TIME"), resp.Int(ms))
+	}
+	if options.RetryCount > 0 {
+		args = append(args, resp.String("RETRYCOUNT"), resp.Int(options.RetryCount))
+	}
+	if options.Force {
+		args = append(args, resp.String("FORCE"))
+	}
+	if options.JustID {
+		args = append(args, resp.String("JUSTID"))
+	}
+	if options.LastID != "" {
+		args = append(args, resp.String("LASTID"), resp.String(options.LastID))
+	}
+	p.do("XCLAIM", args...)
+}
+
+// XAutoClaim changes the ownership of pending entries idle for more than minIdle to a consumer
+func (p *Pipeline) XAutoClaim(key, group, consumer string, minIdle time.Duration, start string, count int64, justID bool) {
+	if start == "" {
+		start = "0-0"
+	}
+	args := []resp.Arg{
+		resp.Key(key),
+		resp.String(group),
+		resp.String(consumer),
+		resp.Int(int64(minIdle / time.Millisecond)),
+		resp.String(start),
+	}
+	if count > 0 {
+		args = append(args, resp.String("COUNT"), resp.Int(count))
+	}
+	if justID {
+		args = append(args, resp.String("JUSTID"))
+	}
+	p.do("XAUTOCLAIM", args...)
+}
+
+// XPending returns a summary of the pending entries of a group
+func (p *Pipeline) XPending(key, group string) {
+	p.do("XPENDING", resp.Key(key), resp.String(group))
+}
+
+// XPendingRange options
+type XPendingRange struct {
+	Idle     time.Duration
+	Start    string // Defaults to "-"
+	End      string // Defaults to "+"
+	Count    int64
+	Consumer string
+}
+
+// XPendingRange returns the pending entries of a group
+func (p *Pipeline) XPendingRange(key, group string, options XPendingRange) {
+	args := []resp.Arg{resp.Key(key), resp.String(group)}
+	if options.Idle > 0 {
+		args = append(args, resp.String("IDLE"), resp.Int(int64(options.Idle/time.Millisecond)))
+	}
+	if options.Start == "" {
+		options.Start = "-"
+	}
+	if options.End == "" {
+		options.End = "+"
+	}
+	if options.Count <= 0 {
+		options.Count = defaultScanCount
+	}
+	args = append(args, resp.String(options.Start), resp.String(options.End), resp.Int(options.Count))
+	if options.Consumer != "" {
+		args = append(args, resp.String(options.Consumer))
+	}
+	p.do("XPENDING", args...)
+}
+
+// XInfoStream returns information about a stream
+func (p *Pipeline) XInfoStream(key string, full bool) {
+	if full {
+		p.do("XINFO", resp.String("STREAM"), resp.Key(key), resp.String("FULL"))
+	} else {
+		p.do("XINFO", resp.String("STREAM"), resp.Key(key))
+	}
+}
+
+// XInfoGroups returns the consumer groups of a stream
+func (p *Pipeline) XInfoGroups(key string) {
+	p.do("XINFO", resp.String("GROUPS"), resp.Key(key))
+}
+
+// XInfoConsumers returns the consumers of a group
+func (p *Pipeline) XInfoConsumers(key, group string) {
+	p.do("XINFO", resp.String("CONSUMERS"), resp.Key(key), resp.String(group))
+}
+
+// XGroupCreate creates a consumer group.
+// Use "$" as ID to deliver only new entries.
+func (p *Pipeline) XGroupCreate(key, group, id string, mkStream bool) {
+	if mkStream {
+		p.do("XGROUP", resp.String("CREATE"), resp.Key(key), resp.String(group), resp.String(id), resp.String("MKSTREAM"))
+	} else {
+		p.do("XGROUP", resp.String("CREATE"), resp.Key(key), resp.String(group), resp.String(id))
+	}
+}
+
+// XGroupSetID sets the last delivered ID of a consumer group
+func (p *Pipeline) XGroupSetID(key, group, id string) {
+	p.do("XGROUP", resp.String("SETID"), resp.Key(key), resp.String(group), resp.String(id))
+}
+
+// XGroupDestroy destroys a consumer group
+func (p *Pipeline) XGroupDestroy(key, group string) {
+	p.do("XGROUP", resp.String("DESTROY"), resp.Key(key), resp.String(group))
+}
+
+// XGroupCreateConsumer creates a consumer in a group
+func (p *Pipeline) XGroupCreateConsumer(key, group, consumer string) {
+	p.do("XGROUP", resp.String("CREATECONSUMER"), resp.Key(key), resp.String(group), resp.String(consumer))
+}
+
+// XGroupDelConsumer deletes a consumer from a group
+func (p *Pipeline) XGroupDelConsumer(key, group, consumer string) {
+	p.do("XGROUP", resp.String("DELCONSUMER"), resp.Key(key), resp.String(group), resp.String(consumer))
+}
+
 // Strings
 
 func (p *Pipeline) Append(key string, value resp.Arg) {
@@ -2,9 +2,10 @@ package redis
 
 import (
 	"bufio"
-	"math"
+	"context"
+	"crypto/tls"
 	"net"
-	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/alxarch/fastredis/resp"
@@ -19,6 +20,14 @@ type Conn struct {
 	lastUsedAt time.Time
 	createdAt  time.Time
 	options    *ConnOptions
+	info       ServerInfo
+	deadline   time.Time           // deadline of the current context
+	block      time.Duration       // extra read timeout for blocking commands, negative if indefinite
+	epoch      int64               // pool epoch when the connection was opened
+	bufs       net.Buffers         // scratch for vectored writes
+	wbuf       []byte              // scratch for copying referenced arguments on connections without vectored writes
+	cancelled  int32               // set when the context of the current operation is done
+	scripts    map[string]struct{} // SHA1 of scripts loaded on the connection
 }
 
 // ConnOptions holds connection options
@@ -26,30 +35,175 @@ type ConnOptions struct {
 	ReadBufferSize int
 	ReadTimeout    time.Duration
 	WriteTimeout   time.Duration
-	WriteOnly      bool
-	// MaxRetries     int
-	// RetryBackoff   time.Duration
+	// DialTimeout limits connecting and the TLS handshake in Dial.
+	// If it is zero the TLS handshake times out after 10 seconds.
+	DialTimeout time.Duration
+	WriteOnly   bool
+	// TLSConfig enables TLS if not nil
+	TLSConfig *tls.Config
+	// Protocol is the RESP protocol version negotiated with HELLO.
+	// If it is zero no HELLO command is sent.
+	Protocol   int
+	Username   string
+	Password   string
+	ClientName string
 }
 
 // Dial opens a connection to a redis server
+//
+// Addresses of the form unix:/path/to/socket or absolute paths connect to a unix domain socket.
 func Dial(addr string, options ConnOptions) (*Conn, error) {
-	// addr := options.Addr()
-	conn, err := net.Dial("tcp", addr)
+	return DialNetwork("", addr, options)
+}
+
+// DialNetwork opens a connection to a redis server on the named network.
+//
+// If network is empty it is selected from the address as in Dial.
+func DialNetwork(network, addr string, options ConnOptions) (*Conn, error) {
+	if network == "" {
+		network, addr = splitNetworkAddress(addr)
+	}
+	conn, err := net.DialTimeout(network, addr, options.DialTimeout)
 	if err != nil {
 		return nil, err
 	}
-	if options.WriteOnly {
+	if options.TLSConfig != nil {
+		timeout := options.DialTimeout
+		if timeout <= 0 {
+			timeout = defaultTLSHandshakeTimeout
+		}
+		conn, err = clientTLS(conn, addr, options.TLSConfig, timeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+	writeOnly := options.WriteOnly
+	options.WriteOnly = false
+	c := newConn(conn, options)
+	if err := c.handshake(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if writeOnly {
 		if conn, ok := conn.(closeReader); ok {
 			err = conn.CloseRead()
 		} else {
 			err = errConnWriteOnly
 		}
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.options.WriteOnly = true
 	}
-	if err != nil {
+	return c, nil
+}
+
+const defaultTLSHandshakeTimeout = 10 * time.Second
+
+// clientTLS performs a TLS client handshake over conn
+func clientTLS(conn net.Conn, addr string, config *tls.Config, timeout time.Duration) (net.Conn, error) {
+	if config.ServerName == "" && !config.InsecureSkipVerify {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		config = config.Clone()
+		config.ServerName = host
+	}
+	tlsConn := tls.Client(conn, config)
+	if timeout > 0 {
+		tlsConn.SetDeadline(time.Now().Add(timeout))
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
 		return nil, err
 	}
+	if timeout > 0 {
+		tlsConn.SetDeadline(time.Time{})
+	}
+	return tlsConn, nil
+}
+
+// ServerInfo holds the server information returned by HELLO
+type ServerInfo struct {
+	Server   string
+	Version  string
+	Protocol int64
+	ID       int64
+	Mode     string
+	Role     string
+}
+
+// ServerInfo returns the server information received during the connection handshake
+func (c *Conn) ServerInfo() ServerInfo {
+	return c.info
+}
+
+// handshake sets up a new connection according to its options
+func (c *Conn) handshake() error {
+	o := c.options
+	if o.Protocol > 0 {
+		_, err := c.Hello(int64(o.Protocol), o.Username, o.Password, o.ClientName)
+		return err
+	}
+	p := BlankPipeline(-1)
+	defer ReleasePipeline(p)
+	if o.Password != "" {
+		p.AuthUser(o.Username, o.Password)
+	}
+	if o.ClientName != "" {
+		p.ClientSetName(o.ClientName)
+	}
+	if p.Len() == 0 {
+		return nil
+	}
+	r := BlankReply()
+	defer ReleaseReply(r)
+	if err := c.Do(p, r); err != nil {
+		return err
+	}
+	for i := 0; i < p.Len(); i++ {
+		if err := r.Value().Get(i).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	return newConn(conn, options), nil
+// Hello negotiates the protocol version with the server
+func (c *Conn) Hello(proto int64, username, password, clientName string) (ServerInfo, error) {
+	p := BlankPipeline(-1)
+	defer ReleasePipeline(p)
+	p.Hello(proto, username, password, clientName)
+	r := BlankReply()
+	defer ReleaseReply(r)
+	if err := c.Do(p, r); err != nil {
+		return ServerInfo{}, err
+	}
+	v := r.Value().Get(0)
+	if err := v.Err(); err != nil {
+		return ServerInfo{}, err
+	}
+	info := ServerInfo{}
+	v.ForEachKV(func(k []byte, v resp.Value) {
+		switch string(k) {
+		case "server":
+			info.Server = string(v.Bytes())
+		case "version":
+			info.Version = string(v.Bytes())
+		case "proto":
+			info.Protocol, _ = v.Int()
+		case "id":
+			info.ID, _ = v.Int()
+		case "mode":
+			info.Mode = string(v.Bytes())
+		case "role":
+			info.Role = string(v.Bytes())
+		}
+	})
+	c.info = info
+	return info, nil
 }
 
 const minBufferSize = 4096
@@ -89,7 +243,15 @@ func (c *Conn) Do(pipeline *Pipeline, reply *resp.Reply) (err error) {
 	if n <= 0 {
 		return nil
 	}
-	_, err = c.Write(pipeline.B)
+	if pipeline.scripts > 0 && !c.options.WriteOnly {
+		if err := c.loadScripts(pipeline); err != nil {
+			return err
+		}
+	}
+	if c.block = pipeline.block; c.block != 0 {
+		defer func() { c.block = 0 }()
+	}
+	err = c.writePipeline(pipeline)
 	if err == nil {
 		discard := int64(pipeline.offset)
 		if reply == nil {
@@ -103,13 +265,21 @@ func (c *Conn) Do(pipeline *Pipeline, reply *resp.Reply) (err error) {
 			// WriteOnly connection cannot read reply
 			return errConnWriteOnly
 		}
+		var v resp.Value
+		var mark resp.Mark
+		if reply != nil {
+			mark = reply.Mark()
+		}
 		if discard > 0 {
 			err = resp.DiscardN(c.r, discard)
 			if err == nil && n > 0 {
-				_, err = reply.ReadFromN(c.r, n)
+				v, err = reply.ReadFromN(c.r, n)
 			}
 		} else if n > 0 {
-			_, err = reply.ReadFromN(c.r, n)
+			v, err = reply.ReadFromN(c.r, n)
+		}
+		if err == nil && n > 0 && pipeline.scripts > 0 && pipeline.Streams() == 0 {
+			return c.reloadScripts(pipeline, reply, mark, v)
 		}
 	}
 	if err != nil {
@@ -118,84 +288,204 @@ func (c *Conn) Do(pipeline *Pipeline, reply *resp.Reply) (err error) {
 	return
 }
 
-// PopPush executes the blocking BRPOPLPUSH command
-func (c *Conn) PopPush(src, dst string, timeout time.Duration) (string, error) {
-	p := BlankPipeline(c.db)
-	defer ReleasePipeline(p)
-	p.BRPopLPush(src, dst, timeout)
-	rep := BlankReply()
-	defer ReleaseReply(rep)
-	err := c.Do(p, rep)
-	if err != nil {
-		return "", err
-	}
-	value := rep.Value()
-	if value.IsNull() {
-		return "", new(TimeoutError)
+// writePipeline writes the commands of a pipeline along with referenced and streamed arguments
+func (c *Conn) writePipeline(pipeline *Pipeline) error {
+	switch {
+	case pipeline.Segments() == 0:
+		_, err := c.Write(pipeline.B)
+		return err
+	case pipeline.Streams() == 0 && !isTCPConn(c.conn):
+		// Other connections like TLS would write each buffer separately
+		c.wbuf = pipeline.AppendRESP(c.wbuf[:0])
+		_, err := c.Write(c.wbuf)
+		return err
+	case pipeline.Streams() == 0:
+		// Write referenced arguments without copying them
+		bufs, err := pipeline.Buffers(c.bufs[:0])
+		if err == nil {
+			_, err = c.writeBuffers(bufs)
+		}
+		c.bufs = bufs
+		for i := range c.bufs {
+			c.bufs[i] = nil
+		}
+		return err
+	default:
+		if _, err := pipeline.WriteTo(c); err != nil {
+			// A partially written command leaves the connection out of sync
+			return c.closeWithError(err)
+		}
+		return nil
 	}
-	return string(value.Get(0).Bytes()), nil
 }
 
-func (c *Conn) bpop(cmd string, timeout time.Duration, key string, keys []string) (k, v string, score float64, err error) {
-	p := BlankPipeline(c.db)
-	defer ReleasePipeline(p)
-	p.Command(cmd, len(keys)+2)
-	p.Arg(resp.Key(key))
-	for _, key := range keys {
-		p.Arg(resp.Key(key))
-	}
-	p.Arg(resp.Int(int64(timeout / time.Second)))
-	rep := BlankReply()
-	defer ReleaseReply(rep)
-	err = c.Do(p, rep)
-	if err != nil {
-		return
+// DoContext executes pipeline reading responses into reply.
+//
+// The context deadline caps the connection read and write timeouts.
+// If the context is cancelled while waiting for the server the connection is closed.
+func (c *Conn) DoContext(ctx context.Context, pipeline *Pipeline, reply *resp.Reply) error {
+	return c.withContext(ctx, func() error {
+		return c.Do(pipeline, reply)
+	})
+}
+
+// Visit executes a pipeline calling fn for each value of the replies as it is read.
+//
+// Values are not kept in memory so huge replies can be processed in constant memory.
+// The path of each value starts with the index of the command in the pipeline.
+// If fn returns an error the remaining replies are discarded and the error is returned.
+// Scripts not yet loaded on the connection are loaded first but commands failing with NOSCRIPT are not executed again.
+func (c *Conn) Visit(pipeline *Pipeline, fn resp.VisitFunc) (err error) {
+	if c.err != nil {
+		return c.err
 	}
-	value := rep.Value()
-	if value.IsNull() {
-		err = new(TimeoutError)
-		return
+	if c.options.WriteOnly {
+		return errConnWriteOnly
 	}
-	switch cmd {
-	case "BZPOPMAX", "BZPOPMIN":
-		k = string(value.Get(0).Bytes())
-		v = string(value.Get(2).Bytes())
-		switch s := string(value.Get(1).Bytes()); s {
-		case "+inf":
-			score = math.Inf(+1)
-		case "-inf":
-			score = math.Inf(-1)
-		default:
-			score, _ = strconv.ParseFloat(s, 64)
+	n := int64(pipeline.Len())
+	if n <= 0 {
+		return nil
+	}
+	if pipeline.scripts > 0 {
+		if err := c.loadScripts(pipeline); err != nil {
+			return err
 		}
-	default:
-		k = string(value.Get(0).Bytes())
-		v = string(value.Get(1).Bytes())
-		score = math.NaN()
+	}
+	if c.block = pipeline.block; c.block != 0 {
+		defer func() { c.block = 0 }()
+	}
+	if err = c.writePipeline(pipeline); err != nil {
+		return
+	}
+	if err = resp.DiscardN(c.r, int64(pipeline.offset)); err != nil {
+		return c.closeWithError(err)
+	}
+	r := BlankReply()
+	defer ReleaseReply(r)
+	var visitErr error
+	err = r.VisitN(c.r, n, func(depth int, path []int, v resp.Value) error {
+		visitErr = fn(depth, path, v)
+		return visitErr
+	})
+	if err != nil && err != visitErr {
+		// The stream is out of sync
+		err = c.closeWithError(err)
 	}
 	return
 }
 
-// PopLeft executes the blocking BLPOP command
-func (c *Conn) PopLeft(timeout time.Duration, key string, keys ...string) (k, v string, err error) {
-	k, v, _, err = c.bpop("BLPOP", timeout, key, keys)
-	return
+// VisitContext executes a pipeline calling fn for each value of the replies as it is read.
+//
+// The context deadline caps the connection read and write timeouts.
+func (c *Conn) VisitContext(ctx context.Context, pipeline *Pipeline, fn resp.VisitFunc) error {
+	return c.withContext(ctx, func() error {
+		return c.Visit(pipeline, fn)
+	})
 }
 
-// PopRight executes the blocking BRPOP command
-func (c *Conn) PopRight(timeout time.Duration, key string, keys ...string) (k, v string, err error) {
-	k, v, _, err = c.bpop("BRPOP", timeout, key, keys)
-	return
+// aLongTimeAgo is a deadline in the past used to interrupt blocked I/O
+var aLongTimeAgo = time.Unix(1, 0)
+
+// withContext runs fn honoring the context deadline and cancellation
+func (c *Conn) withContext(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c.err != nil {
+		return c.err
+	}
+	if c.conn == nil {
+		return c.closeWithError(errConnClosed)
+	}
+	deadline, hasDeadline := ctx.Deadline()
+	done := ctx.Done()
+	if !hasDeadline && done == nil {
+		return fn()
+	}
+	conn := c.conn
+	c.deadline = deadline
+	var stop, stopped chan struct{}
+	if done != nil {
+		stop, stopped = make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(stopped)
+			select {
+			case <-done:
+				// The flag keeps later I/O calls from resetting the deadline
+				atomic.StoreInt32(&c.cancelled, 1)
+				conn.SetDeadline(aLongTimeAgo)
+			case <-stop:
+			}
+		}()
+	}
+	err := fn()
+	if stop != nil {
+		close(stop)
+		<-stopped
+	}
+	c.deadline = time.Time{}
+	atomic.StoreInt32(&c.cancelled, 0)
+	if c.conn != nil {
+		// Clear deadlines set by the context, timeouts are set again on each I/O
+		c.conn.SetDeadline(time.Time{})
+	}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		// The I/O deadline can expire just before the context timer fires
+		if e, ok := err.(net.Error); ok && e.Timeout() && hasDeadline && !time.Now().Before(deadline) {
+			return context.DeadlineExceeded
+		}
+	}
+	return err
 }
 
-// PopMin executes the blocking BZPOPMIN command
-func (c *Conn) PopMin(timeout time.Duration, key string, keys ...string) (k, v string, score float64, err error) {
-	return c.bpop("BZPOPMIN", timeout, key, keys)
+// readTimeout returns the read timeout extended by the block duration of the current pipeline
+func (c *Conn) readTimeout() time.Duration {
+	timeout := c.options.ReadTimeout
+	switch {
+	case timeout <= 0:
+		return 0
+	case c.block < 0:
+		return 0
+	default:
+		return timeout + c.block
+	}
 }
 
-// PopMax executes the blocking BZPOPMAX command
-func (c *Conn) PopMax(timeout time.Duration, key string, keys ...string) (k, v string, score float64, err error) {
-	return c.bpop("BZPOPMIN", timeout, key, keys)
+// setDeadline sets the deadline for the next write or read with timeout
+func (c *Conn) setDeadline(write bool, timeout time.Duration) error {
+	now := time.Now()
+	c.lastUsedAt = now
+	deadline := c.ioDeadline(now, timeout)
+	for {
+		var err error
+		if write {
+			err = c.conn.SetWriteDeadline(deadline)
+		} else {
+			err = c.conn.SetReadDeadline(deadline)
+		}
+		if err != nil || deadline == aLongTimeAgo || atomic.LoadInt32(&c.cancelled) == 0 {
+			return err
+		}
+		// The context was cancelled while the deadline was being set
+		deadline = aLongTimeAgo
+	}
+}
+
+// ioDeadline returns the deadline for an I/O operation with timeout
+func (c *Conn) ioDeadline(now time.Time, timeout time.Duration) (deadline time.Time) {
+	if atomic.LoadInt32(&c.cancelled) != 0 {
+		return aLongTimeAgo
+	}
+	if timeout > 0 {
+		deadline = now.Add(timeout)
+	}
+	if !c.deadline.IsZero() && (deadline.IsZero() || c.deadline.Before(deadline)) {
+		deadline = c.deadline
+	}
+	return
 }
 
 func (c *Conn) closeWithError(err error) error {
@@ -216,11 +506,8 @@ func (c *Conn) Write(p []byte) (n int, err error) {
 	if c.conn == nil {
 		return 0, c.closeWithError(errConnClosed)
 	}
-	if c.options.WriteTimeout > 0 {
-		now := time.Now()
-		deadline := now.Add(c.options.WriteTimeout)
-		c.lastUsedAt = now
-		err = c.conn.SetWriteDeadline(deadline)
+	if c.options.WriteTimeout > 0 || !c.deadline.IsZero() {
+		err = c.setDeadline(true, c.options.WriteTimeout)
 	}
 	if err == nil {
 		n, err = c.conn.Write(p)
@@ -231,6 +518,28 @@ func (c *Conn) Write(p []byte) (n int, err error) {
 	return
 }
 
+func isTCPConn(conn net.Conn) bool {
+	_, ok := conn.(*net.TCPConn)
+	return ok
+}
+
+// writeBuffers writes bufs with a single vectored write if the connection supports it
+func (c *Conn) writeBuffers(bufs net.Buffers) (n int64, err error) {
+	if c.conn == nil {
+		return 0, c.closeWithError(errConnClosed)
+	}
+	if c.options.WriteTimeout > 0 || !c.deadline.IsZero() {
+		err = c.setDeadline(true, c.options.WriteTimeout)
+	}
+	if err == nil {
+		n, err = bufs.WriteTo(c.conn)
+	}
+	if err != nil {
+		err = c.closeWithError(err)
+	}
+	return
+}
+
 func (c *Conn) Read(p []byte) (n int, err error) {
 	if c.conn == nil {
 		return 0, c.closeWithError(errConnClosed)
@@ -241,11 +550,8 @@ func (c *Conn) Read(p []byte) (n int, err error) {
 	if c.options.WriteOnly {
 		return 0, errConnWriteOnly
 	}
-	if c.options.ReadTimeout > 0 {
-		now := time.Now()
-		deadline := now.Add(c.options.ReadTimeout)
-		c.lastUsedAt = now
-		err = c.conn.SetReadDeadline(deadline)
+	if c.options.ReadTimeout > 0 || !c.deadline.IsZero() {
+		err = c.setDeadline(false, c.readTimeout())
 	}
 	if err == nil {
 		n, err = c.conn.Read(p)
@@ -258,9 +564,14 @@ func (c *Conn) Read(p []byte) (n int, err error) {
 
 // Auth authenticates a connection to the server
 func (c *Conn) Auth(password string) error {
+	return c.AuthUser("", password)
+}
+
+// AuthUser authenticates a connection to the server as an ACL user
+func (c *Conn) AuthUser(username, password string) error {
 	p := BlankPipeline(-1)
 	defer ReleasePipeline(p)
-	p.Auth(password)
+	p.AuthUser(username, password)
 	r := BlankReply()
 	defer ReleaseReply(r)
 	if err := c.Do(p, r); err != nil {
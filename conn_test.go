@@ -1,7 +1,15 @@
 package redis
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/alxarch/fastredis/resp"
 )
@@ -54,3 +62,297 @@ func BenchmarkPipeline(b *testing.B) {
 		p.HIncrBy("foo", "bar", 1)
 	}
 }
+
+func TestConnHello(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		buf := make([]byte, 4096)
+		if _, err := server.Read(buf); err != nil {
+			return
+		}
+		b := resp.Buffer{}
+		b.Map(4)
+		b.BulkString("server")
+		b.BulkString("redis")
+		b.BulkString("version")
+		b.BulkString("6.2.0")
+		b.BulkString("proto")
+		b.Int(3)
+		b.BulkString("role")
+		b.BulkString("master")
+		server.Write(b.B)
+	}()
+	conn := newConn(client, ConnOptions{Protocol: 3, ClientName: "test"})
+	defer conn.Close()
+	if err := conn.handshake(); err != nil {
+		t.Fatalf("Handshake failed: %s", err)
+	}
+	info := conn.ServerInfo()
+	if info.Version != "6.2.0" || info.Protocol != 3 || info.Role != "master" {
+		t.Errorf("Invalid server info: %v", info)
+	}
+}
+
+func TestConn_DoContext(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		// Read the command but never reply
+		buf := make([]byte, 4096)
+		server.Read(buf)
+	}()
+	conn := newConn(client, ConnOptions{})
+	p := BlankPipeline(0)
+	defer ReleasePipeline(p)
+	p.Get("foo")
+	r := BlankReply()
+	defer ReleaseReply(r)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := conn.DoContext(ctx, p, r); err != context.DeadlineExceeded {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestConn_CancelBetweenReads(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := newConn(client, ConnOptions{ReadTimeout: time.Minute})
+	ctx, cancel := context.WithCancel(context.Background())
+	start := time.Now()
+	err := conn.withContext(ctx, func() error {
+		cancel()
+		// Let the context watcher interrupt the connection before the next read
+		time.Sleep(10 * time.Millisecond)
+		_, err := conn.r.ReadByte()
+		return err
+	})
+	if err != context.Canceled {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Cancelled read took %s", d)
+	}
+}
+
+func TestConn_Visit(t *testing.T) {
+	s := &fakeServer{
+		handle: func(args []string, w *resp.Buffer) {
+			switch args[0] {
+			case "LRANGE":
+				w.Array(1000)
+				for i := 0; i < 1000; i++ {
+					w.BulkString(strconv.Itoa(i))
+				}
+			default:
+				w.SimpleString("OK")
+			}
+		},
+	}
+	nc, _ := s.Dial("", 0)
+	conn := newConn(nc, ConnOptions{})
+	defer conn.Close()
+	p := BlankPipeline(0)
+	defer ReleasePipeline(p)
+	p.Ping("")
+	p.LRange("foo", 0, -1)
+	sum := int64(0)
+	err := conn.Visit(p, func(depth int, path []int, v resp.Value) error {
+		if depth == 1 && path[0] == 1 {
+			n, _ := v.Int()
+			sum += n
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != 999*1000/2 {
+		t.Errorf("Invalid sum %d", sum)
+	}
+	// The connection is still usable
+	r := BlankReply()
+	defer ReleaseReply(r)
+	if err := conn.Do(p, r); err != nil {
+		t.Fatal(err)
+	}
+	if n := r.Value().Get(1).Len(); n != 1000 {
+		t.Errorf("Invalid reply size %d", n)
+	}
+}
+
+// largeArgsConn opens a connection to a TCP server that discards everything written to it
+func largeArgsConn(tb testing.TB) (*Conn, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(io.Discard, conn)
+		}
+	}()
+	nc, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		ln.Close()
+		tb.Fatal(err)
+	}
+	conn := newConn(nc, ConnOptions{})
+	return conn, func() {
+		conn.Close()
+		ln.Close()
+	}
+}
+
+func TestConn_WriteLargeArgs(t *testing.T) {
+	var written bytes.Buffer
+	s := &fakeServer{
+		handle: func(args []string, w *resp.Buffer) {
+			written.WriteString(args[2])
+			w.SimpleString("OK")
+		},
+	}
+	addr, stop := s.listen(t)
+	defer stop()
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := newConn(nc, ConnOptions{})
+	defer conn.Close()
+	p := BlankPipeline(0)
+	defer func() { ReleasePipeline(p) }()
+	p.RefThreshold = 1024
+	value := bytes.Repeat([]byte("0123456789"), 1000)
+	p.Set("foo", resp.Raw(value), 0)
+	p.Set("bar", resp.Raw([]byte("small")), 0)
+	p.Set("baz", resp.Raw(value), 0)
+	if n := p.Segments(); n != 2 {
+		t.Fatalf("Invalid segments %d", n)
+	}
+	r := BlankReply()
+	defer ReleaseReply(r)
+	if err := conn.Do(p, r); err != nil {
+		t.Fatal(err)
+	}
+	if want := string(value) + "small" + string(value); written.String() != want {
+		t.Errorf("Invalid payload size %d", written.Len())
+	}
+	for i := 0; i < 3; i++ {
+		if v := r.Value().Get(i); string(v.Bytes()) != "OK" {
+			t.Errorf("Invalid reply %d %q", i, v.Bytes())
+		}
+	}
+	// ReleasePipeline resets the threshold of pooled pipelines
+	ReleasePipeline(p)
+	p = BlankPipeline(0)
+	if p.RefThreshold != 0 {
+		t.Errorf("Invalid threshold %d", p.RefThreshold)
+	}
+}
+
+type countWritesConn struct {
+	net.Conn
+	writes int
+}
+
+func (c *countWritesConn) Write(p []byte) (int, error) {
+	c.writes++
+	return c.Conn.Write(p)
+}
+
+func TestConn_WriteLargeArgsCopy(t *testing.T) {
+	s := &fakeServer{
+		handle: func(args []string, w *resp.Buffer) {
+			w.Int(int64(len(args[2])))
+		},
+	}
+	nc, _ := s.Dial("", 0)
+	cw := &countWritesConn{Conn: nc}
+	conn := newConn(cw, ConnOptions{})
+	defer conn.Close()
+	p := BlankPipeline(0)
+	defer ReleasePipeline(p)
+	p.RefThreshold = 1024
+	value := bytes.Repeat([]byte("0123456789"), 1000)
+	p.Set("foo", resp.Raw(value), 0)
+	r := BlankReply()
+	defer ReleaseReply(r)
+	if err := conn.Do(p, r); err != nil {
+		t.Fatal(err)
+	}
+	// Connections other than TCP get the pipeline in a single write
+	if cw.writes != 1 {
+		t.Errorf("Invalid number of writes %d", cw.writes)
+	}
+	if n, _ := r.Value().Get(0).Int(); n != int64(len(value)) {
+		t.Errorf("Invalid payload size %d", n)
+	}
+}
+
+func BenchmarkConn_WriteLargeArgs(b *testing.B) {
+	for _, size := range []int{4 << 10, 64 << 10, 1 << 20} {
+		value := make([]byte, size)
+		for _, bench := range []struct {
+			name      string
+			threshold int
+		}{
+			{"copy", 0},
+			{"writev", 1024},
+		} {
+			b.Run(fmt.Sprintf("%s-%dK", bench.name, size>>10), func(b *testing.B) {
+				conn, done := largeArgsConn(b)
+				defer done()
+				p := BlankPipeline(0)
+				defer ReleasePipeline(p)
+				b.ReportAllocs()
+				b.SetBytes(int64(4 * size))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					p.Reset()
+					p.RefThreshold = bench.threshold
+					for j := 0; j < 4; j++ {
+						p.Set("foo", resp.Raw(value), 0)
+					}
+					if err := conn.writePipeline(p); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestDial_TLSHandshakeTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		// Accept connections but never answer the handshake
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	start := time.Now()
+	_, err = Dial(ln.Addr().String(), ConnOptions{
+		DialTimeout: 50 * time.Millisecond,
+		TLSConfig:   &tls.Config{InsecureSkipVerify: true},
+	})
+	if err == nil {
+		t.Fatal("Handshake did not fail")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Handshake took %s", d)
+	}
+}
@@ -0,0 +1,114 @@
+package redis
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+// Future is a pipeline sent with Mux.Send that is waiting for its replies
+type Future struct {
+	req   *muxRequest
+	reply *resp.Reply
+	err   error
+	done  bool
+}
+
+// Send sends a pipeline without waiting for its replies.
+//
+// The pipeline can be reset and reused as soon as Send returns.
+// Send blocks only while the Mux has MaxPending commands waiting for replies.
+// Each Future should be either waited for or released.
+func (m *Mux) Send(ctx context.Context, p *Pipeline) (*Future, error) {
+	r := BlankReply()
+	f := Future{
+		reply: r,
+	}
+	if p.Len() <= 0 {
+		f.done = true
+		return &f, nil
+	}
+	req, err := m.send(ctx, p, r)
+	if err != nil {
+		ReleaseReply(r)
+		return nil, err
+	}
+	f.req = req
+	return &f, nil
+}
+
+// Wait waits for the replies of the pipeline.
+//
+// The reply is owned by the Future and is valid until Release is called.
+func (f *Future) Wait() (*resp.Reply, error) {
+	return f.WaitContext(context.Background())
+}
+
+// WaitContext waits for the replies of the pipeline until the context is done.
+//
+// If the context is done first the Future is still valid and can be waited for again.
+func (f *Future) WaitContext(ctx context.Context) (*resp.Reply, error) {
+	if f.done {
+		return f.result()
+	}
+	select {
+	case err := <-f.req.done:
+		f.complete(err)
+		return f.result()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Ready reports whether the replies have arrived
+func (f *Future) Ready() bool {
+	if f.done {
+		return true
+	}
+	select {
+	case err := <-f.req.done:
+		f.complete(err)
+		return true
+	default:
+		return false
+	}
+}
+
+// Release releases the reply of the Future.
+//
+// If the replies have not arrived yet they are discarded once they do.
+func (f *Future) Release() {
+	if f.reply == nil {
+		return
+	}
+	if !f.done {
+		if atomic.CompareAndSwapInt32(&f.req.state, muxPending, muxAbandoned) {
+			// The reader will discard the replies, the request is not reused
+			f.req, f.done = nil, true
+		} else {
+			f.complete(<-f.req.done)
+		}
+	}
+	ReleaseReply(f.reply)
+	f.reply = nil
+}
+
+func (f *Future) complete(err error) {
+	putMuxRequest(f.req)
+	f.req = nil
+	f.err = err
+	f.done = true
+}
+
+func (f *Future) result() (*resp.Reply, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.reply == nil {
+		return nil, errFutureReleased
+	}
+	return f.reply, nil
+}
+
+const errFutureReleased = Err("Future released")
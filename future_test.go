@@ -0,0 +1,112 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+func TestMux_Send(t *testing.T) {
+	gate := make(chan struct{})
+	s := &fakeServer{
+		handle: func(args []string, w *resp.Buffer) {
+			switch args[0] {
+			case "ECHO":
+				w.BulkString(args[1])
+			case "GATE":
+				<-gate
+				w.SimpleString("OK")
+			default:
+				w.SimpleString("OK")
+			}
+		},
+	}
+	pool := Pool{Dial: s.Dial}
+	m := pool.Mux(1)
+	m.MaxPending = 3
+	defer m.Close()
+
+	p := BlankPipeline(0)
+	defer ReleasePipeline(p)
+	var futures []*Future
+	for i := 0; i < 3; i++ {
+		p.Reset()
+		p.Echo(strconv.Itoa(i))
+		f, err := m.Send(context.Background(), p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		futures = append(futures, f)
+	}
+	for i := len(futures) - 1; i >= 0; i-- {
+		r, err := futures[i].Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := string(r.Value().Get(0).Bytes()); v != strconv.Itoa(i) {
+			t.Errorf("Invalid reply %q", v)
+		}
+		futures[i].Release()
+		if _, err := futures[i].Wait(); err != errFutureReleased {
+			t.Errorf("Invalid error %v", err)
+		}
+	}
+
+	// Sending blocks while MaxPending commands wait for replies
+	p.Reset()
+	p.Command("GATE", 0)
+	p.Echo("foo")
+	gated, err := m.Send(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := gated.WaitContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Invalid error %v", err)
+	}
+	if gated.Ready() {
+		t.Error("Future ready before reply")
+	}
+	p.Reset()
+	p.Echo("bar")
+	p.Echo("baz")
+	if _, err := m.Send(ctx, p); err != context.DeadlineExceeded {
+		t.Fatalf("Invalid error %v", err)
+	}
+	p.Reset()
+	p.Echo("bar")
+	next, err := m.Send(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(gate)
+	r, err := gated.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := string(r.Value().Get(1).Bytes()); v != "foo" {
+		t.Errorf("Invalid reply %q", v)
+	}
+	gated.Release()
+	// Released futures discard their replies
+	next.Release()
+
+	p.Reset()
+	p.Echo("baz")
+	f, err := m.Send(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Release()
+	r, err = f.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := string(r.Value().Get(0).Bytes()); v != "baz" {
+		t.Errorf("Invalid reply %q", v)
+	}
+}
@@ -1,3 +1,3 @@
 module github.com/alxarch/fastredis
 
-go 1.12
+go 1.16
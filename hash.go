@@ -0,0 +1,319 @@
+package redis
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+// MarshalHash appends the fields of a struct to kvs as hash field/value pairs.
+//
+// Struct fields are mapped to hash fields as described in resp.StructFields.
+//
+// Supported field types are strings, []byte, integers, floats, bools, time.Time,
+// encoding.TextMarshaler/TextUnmarshaler implementations and pointers to them.
+// Times are encoded in RFC3339 format with nanoseconds.
+// The same rules apply to UnmarshalHash and UnmarshalHashFields.
+func MarshalHash(kvs []resp.KV, v interface{}) ([]resp.KV, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return kvs, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return kvs, fmt.Errorf("redis: cannot marshal %s as a hash", rv.Type())
+	}
+	info := hashStructOf(rv.Type())
+	for i := range info.fields {
+		f := &info.fields[i]
+		fv := rv.Field(f.index)
+		if f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		arg, ok, err := hashArg(fv)
+		if err != nil {
+			return kvs, fmt.Errorf("redis: cannot marshal field %s: %s", f.name, err)
+		}
+		if ok {
+			kvs = append(kvs, resp.Pair(f.name, arg))
+		}
+	}
+	return kvs, nil
+}
+
+// UnmarshalHash fills the fields of a struct from an HGETALL reply.
+//
+// Hash fields without a matching struct field are ignored.
+func UnmarshalHash(v resp.Value, dst interface{}) error {
+	rv, info, err := hashTarget(dst)
+	if err != nil {
+		return err
+	}
+	if e := v.Err(); e != nil {
+		return e
+	}
+	v.ForEachKV(func(k []byte, v resp.Value) {
+		if err != nil {
+			return
+		}
+		if i := info.Lookup(k); i != -1 {
+			err = info.fields[i].set(rv, v)
+		}
+	})
+	return err
+}
+
+// UnmarshalHashFields fills the fields of a struct from an HMGET reply for fields.
+//
+// Null replies for missing hash fields leave the struct field unchanged.
+func UnmarshalHashFields(v resp.Value, fields []string, dst interface{}) error {
+	rv, info, err := hashTarget(dst)
+	if err != nil {
+		return err
+	}
+	if e := v.Err(); e != nil {
+		return e
+	}
+	for j, name := range fields {
+		if i := info.Lookup([]byte(name)); i != -1 {
+			if err := info.fields[i].set(rv, v.Get(j)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// HashFields returns the hash field names of a struct type to use with HMGET
+func HashFields(v interface{}) []string {
+	typ := reflect.TypeOf(v)
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil
+	}
+	return hashStructOf(typ).names
+}
+
+// HSetStruct sets the hash fields of a key from the fields of a struct.
+//
+// It fails without adding a command if the struct has no fields to set.
+func (p *Pipeline) HSetStruct(key string, v interface{}) error {
+	kvs, err := MarshalHash(nil, v)
+	if err != nil {
+		return err
+	}
+	if len(kvs) == 0 {
+		return errHashEmpty
+	}
+	p.Command("HSET", 1+2*len(kvs))
+	p.Arg(resp.Key(key))
+	for i := range kvs {
+		kv := &kvs[i]
+		p.Arg(resp.String(kv.Key), kv.Arg)
+	}
+	return nil
+}
+
+// HMGetStruct gets the hash fields matching the fields of a struct.
+// Use UnmarshalHashFields with HashFields(v) to read the reply.
+func (p *Pipeline) HMGetStruct(key string, v interface{}) {
+	p.HMGet(key, HashFields(v)...)
+}
+
+const errHashEmpty = Err("No hash fields to set")
+
+type hashStruct struct {
+	*resp.StructFields
+	fields []hashField // same order as Fields
+	names  []string
+}
+
+type hashField struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+var hashStructs sync.Map // map[reflect.Type]*hashStruct
+
+func hashStructOf(typ reflect.Type) *hashStruct {
+	if info, ok := hashStructs.Load(typ); ok {
+		return info.(*hashStruct)
+	}
+	info := &hashStruct{
+		StructFields: resp.StructFieldsOf(typ),
+	}
+	for _, f := range info.Fields {
+		info.names = append(info.names, f.Name)
+		info.fields = append(info.fields, hashField{
+			name:      f.Name,
+			index:     f.Index,
+			omitEmpty: f.OmitEmpty,
+		})
+	}
+	actual, _ := hashStructs.LoadOrStore(typ, info)
+	return actual.(*hashStruct)
+}
+
+func hashTarget(dst interface{}) (reflect.Value, *hashStruct, error) {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return rv, nil, fmt.Errorf("redis: cannot unmarshal hash into %T", dst)
+	}
+	rv = rv.Elem()
+	return rv, hashStructOf(rv.Type()), nil
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// hashArg converts a struct field to an argument
+func hashArg(v reflect.Value) (resp.Arg, bool, error) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return resp.Arg{}, false, nil
+		}
+		v = v.Elem()
+	}
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		return resp.String(t.Format(time.RFC3339Nano)), true, nil
+	}
+	if v.Type().Implements(textMarshalerType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return resp.Raw(text), err == nil, err
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(textMarshalerType) {
+		text, err := v.Addr().Interface().(encoding.TextMarshaler).MarshalText()
+		return resp.Raw(text), err == nil, err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return resp.String(v.String()), true, nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return resp.Raw(v.Bytes()), true, nil
+		}
+	case reflect.Bool:
+		return resp.Bool(v.Bool()), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return resp.Int(v.Int()), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return resp.Uint(v.Uint()), true, nil
+	case reflect.Float32, reflect.Float64:
+		return resp.Float(v.Float()), true, nil
+	}
+	return resp.Arg{}, false, fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// set sets the struct field from a reply value
+func (f *hashField) set(rv reflect.Value, v resp.Value) error {
+	if v.IsNull() {
+		return nil
+	}
+	if err := setHashValue(rv.Field(f.index), v.Bytes()); err != nil {
+		return fmt.Errorf("redis: cannot unmarshal field %s: %s", f.name, err)
+	}
+	return nil
+}
+
+func setHashValue(v reflect.Value, data []byte) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setHashValue(v.Elem(), data)
+	}
+	if v.Type() == timeType {
+		t, err := parseTime(string(data))
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(data)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(string(data))
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		v.SetBytes(append(v.Bytes()[:0], data...))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(string(data))
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(string(data), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(string(data), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(string(data), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// parseTime parses RFC3339 times or UNIX timestamps in seconds
+func parseTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		if sec, e := strconv.ParseInt(s, 10, 64); e == nil {
+			return time.Unix(sec, 0), nil
+		}
+	}
+	return t, err
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return v.Interface().(time.Time).IsZero()
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package redis
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+type testUser struct {
+	Name     string    `redis:"name"`
+	Age      int       `redis:"age"`
+	Score    float64   `redis:"score"`
+	Admin    bool      `redis:"admin"`
+	Avatar   []byte    `redis:"avatar"`
+	Created  time.Time `redis:"created"`
+	IP       net.IP    `redis:"ip"`
+	Nickname *string   `redis:"nickname,omitempty"`
+	Plain    string
+	Skipped  string `redis:"-"`
+}
+
+func TestHashStruct(t *testing.T) {
+	hash := map[string]string{}
+	s := &fakeServer{
+		handle: func(args []string, w *resp.Buffer) {
+			switch args[0] {
+			case "HSET":
+				for i := 2; i+1 < len(args); i += 2 {
+					hash[args[i]] = args[i+1]
+				}
+				w.Int(int64(len(args)-2) / 2)
+			case "HGETALL":
+				w.Array(2 * len(hash))
+				for k, v := range hash {
+					w.BulkString(k)
+					w.BulkString(v)
+				}
+			case "HMGET":
+				w.Array(len(args) - 2)
+				for _, k := range args[2:] {
+					if v, ok := hash[k]; ok {
+						w.BulkString(v)
+					} else {
+						w.NullString()
+					}
+				}
+			}
+		},
+	}
+	pool := Pool{Dial: s.Dial}
+	defer pool.Close()
+	created := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	user := testUser{
+		Name:    "foo",
+		Age:     42,
+		Score:   1.5,
+		Admin:   true,
+		Avatar:  []byte{1, 2, 3},
+		Created: created,
+		IP:      net.ParseIP("10.0.0.1"),
+		Plain:   "plain",
+		Skipped: "skipped",
+	}
+	p := BlankPipeline(0)
+	defer ReleasePipeline(p)
+	r := BlankReply()
+	defer ReleaseReply(r)
+	if err := p.HSetStruct("user:1", &user); err != nil {
+		t.Fatal(err)
+	}
+	p.HGetAll("user:1")
+	p.HMGetStruct("user:1", &user)
+	if err := pool.Do(p, r); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := r.Value().Get(0).Int(); n != 8 {
+		t.Errorf("Invalid number of fields %d", n)
+	}
+	if _, ok := hash["nickname"]; ok {
+		t.Errorf("Empty field not omitted")
+	}
+	if _, ok := hash["Plain"]; !ok {
+		t.Errorf("Untagged field not set")
+	}
+	check := func(u *testUser) {
+		if u.Name != "foo" || u.Age != 42 || u.Score != 1.5 || !u.Admin {
+			t.Errorf("Invalid user %+v", u)
+		}
+		if string(u.Avatar) != "\x01\x02\x03" || !u.Created.Equal(created) || !u.IP.Equal(user.IP) {
+			t.Errorf("Invalid user %+v", u)
+		}
+		if u.Plain != "plain" || u.Skipped != "" || u.Nickname != nil {
+			t.Errorf("Invalid user %+v", u)
+		}
+	}
+	var all testUser
+	if err := UnmarshalHash(r.Value().Get(1), &all); err != nil {
+		t.Fatal(err)
+	}
+	check(&all)
+	var some testUser
+	if err := UnmarshalHashFields(r.Value().Get(2), HashFields(&some), &some); err != nil {
+		t.Fatal(err)
+	}
+	check(&some)
+
+	hash["age"] = "old"
+	r.Reset()
+	p.Reset()
+	p.HGetAll("user:1")
+	if err := pool.Do(p, r); err != nil {
+		t.Fatal(err)
+	}
+	if err := UnmarshalHash(r.Value().Get(0), &all); err == nil {
+		t.Errorf("Expected an error")
+	}
+}
+
+func TestHSetStruct_Options(t *testing.T) {
+	type opts struct {
+		Name  string `redis:"name,string,omitempty"`
+		Count int    `redis:",omitempty"`
+	}
+	kvs, err := MarshalHash(nil, &opts{Count: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvs) != 1 || kvs[0].Key != "Count" {
+		t.Errorf("Invalid pairs %v", kvs)
+	}
+
+	// Hash fields match struct fields like Value.Decode
+	b := resp.Buffer{}
+	b.BulkStringArray("NAME", "foo", "count", "2")
+	v, err := resp.ParseValue(b.B)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var x, y opts
+	if err := UnmarshalHash(v, &x); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Decode(&y); err != nil {
+		t.Fatal(err)
+	}
+	if x != (opts{Name: "foo", Count: 2}) || x != y {
+		t.Errorf("Invalid unmarshal %+v %+v", x, y)
+	}
+
+	// Empty structs do not add an HSET without fields
+	p := BlankPipeline(0)
+	defer ReleasePipeline(p)
+	if err := p.HSetStruct("key", &opts{}); err != errHashEmpty {
+		t.Errorf("Invalid error %v", err)
+	}
+	if p.Len() != 0 {
+		t.Errorf("Invalid pipeline length %d", p.Len())
+	}
+}
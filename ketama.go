@@ -0,0 +1,78 @@
+package redis
+
+import (
+	"crypto/md5"
+	"sort"
+	"strconv"
+)
+
+// ketamaPointsPerHash is the number of ring points taken from each MD5 digest
+const ketamaPointsPerHash = 4
+
+// ketamaHashesPerNode is the number of MD5 digests computed for each node (160 points)
+const ketamaHashesPerNode = 40
+
+// hashRing is a ketama compatible consistent hash ring
+type hashRing struct {
+	nodes  []string
+	points []ringPoint
+}
+
+type ringPoint struct {
+	hash uint32
+	node int
+}
+
+func newHashRing(nodes []string) *hashRing {
+	ring := hashRing{
+		nodes:  nodes,
+		points: make([]ringPoint, 0, len(nodes)*ketamaHashesPerNode*ketamaPointsPerHash),
+	}
+	var buf []byte
+	for n, node := range nodes {
+		for i := 0; i < ketamaHashesPerNode; i++ {
+			buf = append(buf[:0], node...)
+			buf = append(buf, '-')
+			buf = strconv.AppendInt(buf, int64(i), 10)
+			digest := md5.Sum(buf)
+			for h := 0; h < ketamaPointsPerHash; h++ {
+				ring.points = append(ring.points, ringPoint{
+					hash: ketamaPoint(digest[:], h),
+					node: n,
+				})
+			}
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool {
+		return ring.points[i].hash < ring.points[j].hash
+	})
+	return &ring
+}
+
+func ketamaPoint(digest []byte, h int) uint32 {
+	return uint32(digest[3+h*4])<<24 |
+		uint32(digest[2+h*4])<<16 |
+		uint32(digest[1+h*4])<<8 |
+		uint32(digest[h*4])
+}
+
+// ketamaHash hashes a key to a point on the ring
+func ketamaHash(key string) uint32 {
+	digest := md5.Sum([]byte(key))
+	return ketamaPoint(digest[:], 0)
+}
+
+// node returns the node for a key or an empty string if the ring is empty
+func (ring *hashRing) node(key string) string {
+	if len(ring.points) == 0 {
+		return ""
+	}
+	hash := ketamaHash(hashTag(key))
+	i := sort.Search(len(ring.points), func(i int) bool {
+		return ring.points[i].hash >= hash
+	})
+	if i == len(ring.points) {
+		i = 0
+	}
+	return ring.nodes[ring.points[i].node]
+}
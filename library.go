@@ -0,0 +1,78 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+)
+
+// Library is a Redis Functions library
+type Library struct {
+	name string
+	code string
+}
+
+// ErrInvalidLibrary occurs when a library source has no valid shebang line
+const ErrInvalidLibrary = Err("Invalid library: missing #!lua name=<library> line")
+
+// NewLibrary creates a library from its source.
+//
+// The source must start with a shebang line like #!lua name=mylib.
+func NewLibrary(code string) (*Library, error) {
+	line := code
+	if i := strings.IndexByte(line, '\n'); i != -1 {
+		line = line[:i]
+	}
+	if !strings.HasPrefix(line, "#!") {
+		return nil, ErrInvalidLibrary
+	}
+	for _, field := range strings.Fields(line[2:]) {
+		if strings.HasPrefix(field, "name=") {
+			if name := strings.TrimPrefix(field, "name="); name != "" {
+				return &Library{name: name, code: code}, nil
+			}
+		}
+	}
+	return nil, ErrInvalidLibrary
+}
+
+// Name returns the name of the library
+func (lib *Library) Name() string {
+	return lib.name
+}
+
+// Code returns the source of the library
+func (lib *Library) Code() string {
+	return lib.code
+}
+
+// Load loads the library replacing any previous version with the same name
+func (lib *Library) Load(p *Pipeline) {
+	p.FunctionLoad(lib.code, true)
+}
+
+// loadLibraries loads the pool libraries once on the first connection.
+//
+// Libraries are stored on the server so they are loaded again only if loading fails.
+func (pool *Pool) loadLibraries(ctx context.Context, c *Conn) error {
+	if len(pool.Libraries) == 0 || atomic.LoadInt32(&pool.librariesLoaded) == 1 {
+		return nil
+	}
+	p := BlankPipeline(-1)
+	defer ReleasePipeline(p)
+	for _, lib := range pool.Libraries {
+		lib.Load(p)
+	}
+	r := BlankReply()
+	defer ReleaseReply(r)
+	if err := c.DoContext(ctx, p, r); err != nil {
+		return err
+	}
+	for i := range pool.Libraries {
+		if err := r.Value().Get(i).Err(); err != nil {
+			return err
+		}
+	}
+	atomic.StoreInt32(&pool.librariesLoaded, 1)
+	return nil
+}
@@ -0,0 +1,75 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+const testLibrary = `#!lua name=mylib
+redis.register_function{function_name='myget', callback=function(keys) return redis.call('GET', keys[1]) end, flags={'no-writes'}}
+`
+
+func TestNewLibrary(t *testing.T) {
+	lib, err := NewLibrary(testLibrary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := lib.Name(); name != "mylib" {
+		t.Errorf("Invalid name %q", name)
+	}
+	if _, err := NewLibrary("return 1"); err != ErrInvalidLibrary {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestPool_Libraries(t *testing.T) {
+	var loads []string
+	newServer := func(name string) *fakeServer {
+		return &fakeServer{
+			handle: func(args []string, w *resp.Buffer) {
+				switch args[0] {
+				case "FUNCTION":
+					loads = append(loads, name+" "+args[1]+" "+args[2])
+					w.BulkString("mylib")
+				default:
+					w.BulkString(name)
+				}
+			},
+		}
+	}
+	lib, _ := NewLibrary(testLibrary)
+	master, replica := newServer("master"), newServer("replica")
+	rp := ReplicatedPool{
+		Master: &Pool{
+			Dial:           master.Dial,
+			Libraries:      []*Library{lib},
+			MaxConnections: 1,
+		},
+		Replicas: []*Pool{{Dial: replica.Dial}},
+	}
+	defer rp.Close()
+	p := BlankPipeline(0)
+	defer ReleasePipeline(p)
+	r := BlankReply()
+	defer ReleaseReply(r)
+	p.FCall("myset", resp.Key("foo"), resp.String("bar"))
+	if err := rp.Do(p, r); err != nil {
+		t.Fatal(err)
+	}
+	if v := string(r.Value().Get(0).Bytes()); v != "master" {
+		t.Errorf("FCALL sent to %q", v)
+	}
+	p.Reset()
+	r.Reset()
+	p.FCallRO("myget", resp.Key("foo"))
+	if err := rp.Do(p, r); err != nil {
+		t.Fatal(err)
+	}
+	if v := string(r.Value().Get(0).Bytes()); v != "replica" {
+		t.Errorf("FCALL_RO sent to %q", v)
+	}
+	if len(loads) != 1 || loads[0] != "master LOAD REPLACE" {
+		t.Errorf("Invalid loads %v", loads)
+	}
+}
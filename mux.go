@@ -0,0 +1,453 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+// Mux is a client that shares a few connections between many goroutines.
+//
+// Pipelines executed concurrently are appended to a single outgoing buffer per connection
+// and flushed by a writer goroutine. A reader goroutine reads the replies in order and
+// hands them back to each caller.
+//
+// Commands that change the connection state across pipelines like SELECT, WATCH, CLIENT REPLY
+// or SUBSCRIBE and blocking commands that stall the connection should not be used with a Mux.
+// The leading SELECT of pipelines created with BlankPipeline or Pool.Pipeline is not sent,
+// shared connections stay on the database of the connection returned by Dial.
+// A MULTI/EXEC block inside a single pipeline is executed atomically.
+//
+// Scripts of pipelines are loaded on each shared connection before their first use.
+// Commands failing with NOSCRIPT after the script cache is flushed are not executed again.
+type Mux struct {
+	noCopy
+
+	// Dial opens a new connection
+	Dial func(ctx context.Context) (*Conn, error)
+	// Connections is the number of shared connections (default 1)
+	Connections int
+	// MaxPending is the maximum number of commands sent and waiting for replies.
+	// If it is zero or less there is no limit.
+	// A pipeline with more commands than the limit is sent once no other commands are pending.
+	MaxPending int
+
+	mu     sync.Mutex
+	conns  []*muxConn
+	next   uint32
+	closed bool
+
+	pendingMu sync.Mutex
+	pendingC  sync.Cond
+	pending   int
+}
+
+// Mux creates a multiplexed client using connections to the pool address.
+//
+// Multiplexed connections are not counted towards MaxConnections.
+// Pool.Scripts and Pool.Libraries are loaded on every new shared connection.
+func (pool *Pool) Mux(connections int) *Mux {
+	return &Mux{
+		Dial:        pool.open,
+		Connections: connections,
+	}
+}
+
+// ErrMuxClosed occurs when a Mux is used after Close()
+const ErrMuxClosed = Err("Mux closed")
+
+// Do executes a pipeline on a shared connection
+func (m *Mux) Do(p *Pipeline, r *resp.Reply) error {
+	return m.DoContext(context.Background(), p, r)
+}
+
+// DoContext executes a pipeline on a shared connection honoring the context deadline and cancellation.
+//
+// If the context is done before the replies are read they are discarded when they arrive.
+func (m *Mux) DoContext(ctx context.Context, p *Pipeline, r *resp.Reply) error {
+	if p.Len() <= 0 {
+		return nil
+	}
+	req, err := m.send(ctx, p, r)
+	if err != nil {
+		return err
+	}
+	return req.wait(ctx)
+}
+
+// send appends a pipeline to the outgoing buffer of a shared connection
+func (m *Mux) send(ctx context.Context, p *Pipeline, r *resp.Reply) (*muxRequest, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if p.Streams() > 0 {
+		return nil, errPipelineStreams
+	}
+	n := p.Len()
+	if err := m.acquire(ctx, n); err != nil {
+		return nil, err
+	}
+	mc, err := m.conn(ctx)
+	if err != nil {
+		m.release(n)
+		return nil, err
+	}
+	req := getMuxRequest()
+	req.reply = r
+	req.n = int64(n)
+	req.block = p.block
+	if err := mc.enqueue(p, req); err != nil {
+		m.release(n)
+		putMuxRequest(req)
+		return nil, err
+	}
+	return req, nil
+}
+
+// acquire waits until n more commands can be sent
+func (m *Mux) acquire(ctx context.Context, n int) error {
+	m.pendingMu.Lock()
+	defer m.pendingMu.Unlock()
+	if m.pendingC.L == nil {
+		m.pendingC.L = &m.pendingMu
+	}
+	if max := m.MaxPending; max > 0 && m.pending > 0 && m.pending+n > max {
+		if done := ctx.Done(); done != nil {
+			stop := make(chan struct{})
+			defer close(stop)
+			go func() {
+				select {
+				case <-done:
+					m.pendingMu.Lock()
+					m.pendingC.Broadcast()
+					m.pendingMu.Unlock()
+				case <-stop:
+				}
+			}()
+		}
+		for m.pending > 0 && m.pending+n > max {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			m.pendingC.Wait()
+		}
+	}
+	m.pending += n
+	return nil
+}
+
+// release marks n commands as no longer pending
+func (m *Mux) release(n int) {
+	m.pendingMu.Lock()
+	m.pending -= n
+	if m.pendingC.L != nil {
+		m.pendingC.Broadcast()
+	}
+	m.pendingMu.Unlock()
+}
+
+// Close closes all shared connections failing any pending pipelines
+func (m *Mux) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrMuxClosed
+	}
+	m.closed = true
+	for i, mc := range m.conns {
+		if mc != nil {
+			mc.fail(ErrMuxClosed)
+		}
+		m.conns[i] = nil
+	}
+	return nil
+}
+
+// conn selects a shared connection reconnecting if needed
+func (m *Mux) conn(ctx context.Context) (*muxConn, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrMuxClosed
+	}
+	if m.conns == nil {
+		n := m.Connections
+		if n <= 0 {
+			n = 1
+		}
+		m.conns = make([]*muxConn, n)
+	}
+	i := int(m.next % uint32(len(m.conns)))
+	m.next++
+	if mc := m.conns[i]; mc != nil && !mc.failed() {
+		return mc, nil
+	}
+	mc, err := m.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.conns[i] = mc
+	return mc, nil
+}
+
+func (m *Mux) dial(ctx context.Context) (*muxConn, error) {
+	dial := m.Dial
+	if dial == nil {
+		dial = new(Pool).connect
+	}
+	conn, err := dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if conn.db > 0 {
+		p := BlankPipeline(-1)
+		p.Select(conn.db)
+		r := BlankReply()
+		err = conn.DoContext(ctx, p, r)
+		ReleasePipeline(p)
+		ReleaseReply(r)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	mc := muxConn{
+		mux:     m,
+		conn:    conn,
+		nc:      conn.conn,
+		wake:    make(chan struct{}, 1),
+		batches: make(chan []*muxRequest, muxMaxBatches),
+	}
+	go mc.writer()
+	go mc.reader()
+	return &mc, nil
+}
+
+// muxMaxBatches is the number of written batches waiting for replies before the writer stalls
+const muxMaxBatches = 64
+
+// muxConn is a connection shared by concurrent pipelines
+type muxConn struct {
+	mux     *Mux
+	conn    *Conn    // only accessed by the reader goroutine
+	nc      net.Conn // written by the writer goroutine
+	wake    chan struct{}
+	batches chan []*muxRequest
+
+	mu      sync.Mutex
+	buf     []byte
+	queue   []*muxRequest
+	err     error
+	scripts map[string]struct{} // SHA1 of scripts loaded on the connection
+}
+
+func (mc *muxConn) enqueue(p *Pipeline, req *muxRequest) error {
+	mc.mu.Lock()
+	if mc.err != nil {
+		err := mc.err
+		mc.mu.Unlock()
+		return err
+	}
+	if p.scripts > 0 {
+		mc.loadScripts(p, req)
+	}
+	if p.offset > 0 {
+		// Skip the leading SELECT commands of the pipeline.
+		// They have no referenced arguments so their size in the buffer is the same when copied.
+		start := len(mc.buf)
+		mc.buf = p.AppendRESP(mc.buf)
+		skip := p.cmds[p.offset].start
+		mc.buf = append(mc.buf[:start], mc.buf[start+skip:]...)
+	} else {
+		mc.buf = p.AppendRESP(mc.buf)
+	}
+	mc.queue = append(mc.queue, req)
+	mc.mu.Unlock()
+	mc.signal()
+	return nil
+}
+
+// loadScripts writes SCRIPT LOAD for the scripts of a pipeline not yet sent on the connection.
+// Their replies are discarded with the request.
+func (mc *muxConn) loadScripts(p *Pipeline, req *muxRequest) {
+	w := resp.Buffer{B: mc.buf}
+	for i := p.offset; i < len(p.cmds); i++ {
+		s := p.cmds[i].script
+		if s == nil {
+			continue
+		}
+		if _, ok := mc.scripts[s.sha1]; ok {
+			continue
+		}
+		if mc.scripts == nil {
+			mc.scripts = make(map[string]struct{})
+		}
+		mc.scripts[s.sha1] = struct{}{}
+		w.Array(3)
+		w.BulkString("SCRIPT")
+		w.BulkString("LOAD")
+		w.BulkString(s.src)
+		req.discard++
+	}
+	mc.buf = w.B
+}
+
+func (mc *muxConn) signal() {
+	select {
+	case mc.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (mc *muxConn) failed() bool {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.err != nil
+}
+
+// fail closes the connection, pending requests are failed by the writer and reader goroutines
+func (mc *muxConn) fail(err error) {
+	mc.mu.Lock()
+	if mc.err == nil {
+		mc.err = err
+		mc.nc.Close()
+	}
+	mc.mu.Unlock()
+	mc.signal()
+}
+
+func (mc *muxConn) writer() {
+	var spare []byte
+	for range mc.wake {
+		mc.mu.Lock()
+		if err := mc.err; err != nil {
+			queue := mc.queue
+			mc.queue = nil
+			mc.mu.Unlock()
+			for _, req := range queue {
+				mc.finish(req, err)
+			}
+			close(mc.batches)
+			return
+		}
+		buf, queue := mc.buf, mc.queue
+		mc.buf, mc.queue = spare[:0], nil
+		mc.mu.Unlock()
+		if len(queue) == 0 {
+			spare = buf
+			continue
+		}
+		// Hand the batch to the reader first so that a failed write is reported by the reader
+		mc.batches <- queue
+		if timeout := mc.conn.options.WriteTimeout; timeout > 0 {
+			mc.nc.SetWriteDeadline(time.Now().Add(timeout))
+		}
+		if _, err := mc.nc.Write(buf); err != nil {
+			mc.fail(err)
+		}
+		spare = buf
+	}
+}
+
+func (mc *muxConn) reader() {
+	var err error
+	for batch := range mc.batches {
+		for _, req := range batch {
+			if err == nil {
+				if err = mc.read(req); err != nil {
+					mc.fail(err)
+				}
+			}
+			mc.finish(req, err)
+		}
+	}
+	mc.conn.Close()
+}
+
+// finish releases the commands of a request and notifies the caller
+func (mc *muxConn) finish(req *muxRequest, err error) {
+	mc.mux.release(int(req.n))
+	req.done <- err
+}
+
+// read reads the replies of a request discarding them if the caller has gone away
+func (mc *muxConn) read(req *muxRequest) (err error) {
+	c := mc.conn
+	c.block = req.block
+	defer func() { c.block = 0 }()
+	if req.discard > 0 {
+		if err = resp.DiscardN(c.r, req.discard); err != nil {
+			return
+		}
+	}
+	// Wait for the replies to arrive so that the caller can still go away while the server is busy
+	if _, err = c.r.Peek(1); err != nil {
+		return
+	}
+	if req.reply != nil && atomic.CompareAndSwapInt32(&req.state, muxPending, muxReading) {
+		_, err = req.reply.ReadFromN(c.r, req.n)
+		return
+	}
+	return resp.DiscardN(c.r, req.n)
+}
+
+const (
+	muxPending int32 = iota
+	muxReading
+	muxAbandoned
+)
+
+// muxRequest is a pipeline waiting for its replies
+type muxRequest struct {
+	reply   *resp.Reply
+	n       int64 // number of replies to read
+	discard int64 // number of replies to discard before reading
+	block   time.Duration
+	state   int32
+	done    chan error
+}
+
+func (req *muxRequest) wait(ctx context.Context) error {
+	done := ctx.Done()
+	if done == nil {
+		err := <-req.done
+		putMuxRequest(req)
+		return err
+	}
+	select {
+	case err := <-req.done:
+		putMuxRequest(req)
+		return err
+	case <-done:
+		if atomic.CompareAndSwapInt32(&req.state, muxPending, muxAbandoned) {
+			// The reader will discard the replies, the request is not reused
+			return ctx.Err()
+		}
+		// The replies are already being read into the reply
+		err := <-req.done
+		putMuxRequest(req)
+		return err
+	}
+}
+
+var muxRequestPool sync.Pool
+
+func getMuxRequest() *muxRequest {
+	if x := muxRequestPool.Get(); x != nil {
+		return x.(*muxRequest)
+	}
+	return &muxRequest{
+		done: make(chan error, 1),
+	}
+}
+
+func putMuxRequest(req *muxRequest) {
+	req.reply = nil
+	req.discard = 0
+	req.state = muxPending
+	muxRequestPool.Put(req)
+}
@@ -0,0 +1,220 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+func TestMux_Do(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		dials int
+	)
+	s := &fakeServer{
+		handle: func(args []string, w *resp.Buffer) {
+			switch args[0] {
+			case "ECHO":
+				w.BulkString(args[1])
+			case "SLOW":
+				time.Sleep(50 * time.Millisecond)
+				w.SimpleString("OK")
+			default:
+				w.SimpleString("OK")
+			}
+		},
+	}
+	pool := Pool{
+		Dial: func(addr string, timeout time.Duration) (net.Conn, error) {
+			mu.Lock()
+			dials++
+			mu.Unlock()
+			return s.Dial(addr, timeout)
+		},
+		DB: 2,
+	}
+	m := pool.Mux(2)
+	defer m.Close()
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p := BlankPipeline(0)
+			defer ReleasePipeline(p)
+			r := BlankReply()
+			defer ReleaseReply(r)
+			msg := strconv.Itoa(i)
+			p.Echo(msg)
+			p.Echo(msg + "!")
+			if err := m.Do(p, r); err != nil {
+				t.Error(err)
+				return
+			}
+			if v := string(r.Value().Get(0).Bytes()); v != msg {
+				t.Errorf("Invalid reply %q != %q", v, msg)
+			}
+			if v := string(r.Value().Get(1).Bytes()); v != msg+"!" {
+				t.Errorf("Invalid reply %q != %q", v, msg+"!")
+			}
+		}(i)
+	}
+	wg.Wait()
+	if dials != 2 {
+		t.Errorf("Invalid number of connections %d", dials)
+	}
+
+	// Cancelled requests discard their replies
+	p := BlankPipeline(0)
+	defer ReleasePipeline(p)
+	r := BlankReply()
+	defer ReleaseReply(r)
+	p.Command("SLOW", 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if err := m.DoContext(ctx, p, r); err != context.DeadlineExceeded {
+		t.Errorf("Unexpected error %v", err)
+	}
+	p.Reset()
+	p.Echo("foo")
+	for i := 0; i < 2; i++ {
+		r.Reset()
+		if err := m.Do(p, r); err != nil {
+			t.Fatal(err)
+		}
+		if v := string(r.Value().Get(0).Bytes()); v != "foo" {
+			t.Errorf("Invalid reply %q", v)
+		}
+	}
+
+	m.Close()
+	if err := m.Do(p, r); err != ErrMuxClosed {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestMux_DB(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		dbs []string
+	)
+	s := &fakeServer{
+		handle: func(args []string, w *resp.Buffer) {
+			switch args[0] {
+			case "SELECT":
+				mu.Lock()
+				dbs = append(dbs, args[1])
+				mu.Unlock()
+				w.SimpleString("OK")
+			case "ECHO":
+				w.BulkString(args[1])
+			default:
+				w.SimpleString("OK")
+			}
+		},
+	}
+	pool := Pool{Dial: s.Dial, DB: 2}
+	m := pool.Mux(1)
+	defer m.Close()
+
+	// Shared connections select the pool database when dialed
+	p := BlankPipeline(0)
+	defer ReleasePipeline(p)
+	r := BlankReply()
+	defer ReleaseReply(r)
+	p.Echo("foo")
+	if err := m.Do(p, r); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if len(dbs) != 1 || dbs[0] != "2" {
+		t.Errorf("Invalid databases %v", dbs)
+	}
+	mu.Unlock()
+
+	// The leading SELECT of pool pipelines is not sent on the shared connection
+	p2 := pool.Pipeline()
+	defer ReleasePipeline(p2)
+	p2.Echo("bar")
+	r.Reset()
+	if err := m.Do(p2, r); err != nil {
+		t.Fatal(err)
+	}
+	if v := string(r.Value().Get(0).Bytes()); v != "bar" {
+		t.Errorf("Invalid reply %q", v)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(dbs) != 1 || dbs[0] != "2" {
+		t.Errorf("Invalid databases %v", dbs)
+	}
+}
+
+func TestMux_RunScript(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		cache = map[string]bool{}
+		loads int
+	)
+	s := &fakeServer{
+		handle: func(args []string, w *resp.Buffer) {
+			mu.Lock()
+			defer mu.Unlock()
+			switch args[0] {
+			case "SCRIPT":
+				loads++
+				sum := NewScript(0, args[2]).SHA1()
+				cache[sum] = true
+				w.BulkString(sum)
+			case "EVALSHA":
+				if !cache[args[1]] {
+					w.Error("NOSCRIPT No matching script. Please use EVAL.")
+					return
+				}
+				w.BulkString(args[3])
+			default:
+				w.SimpleString("OK")
+			}
+		},
+	}
+	registered := NewScript(0, "return 1")
+	pool := Pool{Dial: s.Dial, Scripts: new(ScriptRegistry)}
+	pool.Scripts.Register(registered)
+	m := pool.Mux(1)
+	defer m.Close()
+
+	script := NewScript(1, "return KEYS[1]")
+	p := BlankPipeline(0)
+	defer ReleasePipeline(p)
+	r := BlankReply()
+	defer ReleaseReply(r)
+	for i := 0; i < 2; i++ {
+		p.Reset()
+		r.Reset()
+		p.RunScript(script, resp.Key("foo"))
+		p.Echo("bar")
+		if err := m.Do(p, r); err != nil {
+			t.Fatal(err)
+		}
+		if v := string(r.Value().Get(0).Bytes()); v != "foo" {
+			t.Errorf("Invalid reply %q", v)
+		}
+		if n := r.Value().Len(); n != 2 {
+			t.Errorf("Invalid number of replies %d", n)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !cache[registered.SHA1()] {
+		t.Error("Registered script not loaded")
+	}
+	if loads != 2 {
+		t.Errorf("Invalid number of loads %d", loads)
+	}
+}
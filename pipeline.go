@@ -2,15 +2,32 @@ package redis
 
 import (
 	"sync"
+	"time"
 
 	resp "github.com/alxarch/fastredis/resp"
 )
 
 // Pipeline is a command buffer
+//
+// Pipelines with arguments streamed from a reader can only be executed once by Conn.Do or Conn.CopyTo.
+// They cannot be sent through a Mux, split across nodes or retried, and their AppendRESP method panics.
 type Pipeline struct {
 	resp.Buffer
-	offset int
-	n      int
+	offset  int
+	n       int
+	cmds    []command
+	block   time.Duration // longest server side block of all commands, negative if indefinite
+	scripts int           // number of script commands that may need reloading
+}
+
+// command indexes a command in a pipeline buffer
+type command struct {
+	name   string
+	start  int // offset of the command in the buffer
+	key    string
+	hasKey bool
+	block  time.Duration
+	script *Script
 }
 
 // Reset resets a pipeline
@@ -18,6 +35,9 @@ func (p *Pipeline) Reset() {
 	p.Buffer.Reset()
 	p.n = 0
 	p.offset = 0
+	p.block = 0
+	p.scripts = 0
+	p.cmds = p.cmds[:0]
 }
 
 // Len returns the number of commands in a pipeline
@@ -27,21 +47,100 @@ func (p *Pipeline) Len() int {
 
 // Size returns the size of the pipeline in bytes
 func (p *Pipeline) Size() int {
-	return len(p.Buffer.B)
+	return int(p.Buffer.Size())
 }
 
 func (p *Pipeline) do(cmd string, args ...resp.Arg) {
 	p.Command(cmd, len(args))
-	p.Buffer.Arg(args...)
+	p.Arg(args...)
 }
 
 // Command starts a new command with n number of args
 func (p *Pipeline) Command(cmd string, numArgs int) {
+	p.cmds = append(p.cmds, command{
+		name:  cmd,
+		start: len(p.Buffer.B),
+	})
 	p.Buffer.Array(numArgs + 1)
 	p.Buffer.BulkString(cmd)
 	p.n++
 }
 
+// Arg writes command arguments to the pipeline keeping track of the first key of each command
+func (p *Pipeline) Arg(args ...resp.Arg) {
+	if n := len(p.cmds) - 1; 0 <= n && n < len(p.cmds) && !p.cmds[n].hasKey {
+		cmd := &p.cmds[n]
+		for i := range args {
+			if key, ok := args[i].KeyString(); ok {
+				cmd.key, cmd.hasKey = key, true
+				break
+			}
+		}
+	}
+	p.Buffer.Arg(args...)
+}
+
+// command returns the i-th command of the pipeline and the end of its RESP encoding in the buffer
+func (p *Pipeline) command(i int) (*command, int) {
+	if 0 <= i && i < len(p.cmds) {
+		cmd := &p.cmds[i]
+		end := len(p.B)
+		if j := i + 1; j < len(p.cmds) {
+			end = p.cmds[j].start
+		}
+		return cmd, end
+	}
+	return nil, 0
+}
+
+// errPipelineStreams occurs when a pipeline with arguments streamed from a reader needs to be copied
+const errPipelineStreams = Err("Pipeline with streamed arguments cannot be copied")
+
+// appendCommand appends the i-th command of another pipeline
+func (p *Pipeline) appendCommand(src *Pipeline, i int) {
+	cmd, end := src.command(i)
+	if cmd == nil {
+		return
+	}
+	c := *cmd
+	c.start = len(p.B)
+	p.cmds = append(p.cmds, c)
+	p.AppendBuffer(&src.Buffer, cmd.start, end)
+	p.n++
+	p.addBlock(c.block)
+	if c.script != nil {
+		p.scripts++
+	}
+}
+
+// blocking marks the last command as blocking on the server for timeout.
+// A timeout of zero or less blocks indefinitely.
+func (p *Pipeline) blocking(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = -1
+	}
+	if n := len(p.cmds) - 1; 0 <= n && n < len(p.cmds) {
+		p.cmds[n].block = timeout
+	}
+	p.addBlock(timeout)
+}
+
+func (p *Pipeline) addBlock(timeout time.Duration) {
+	switch {
+	case p.block < 0:
+	case timeout < 0:
+		p.block = -1
+	case timeout > p.block:
+		p.block = timeout
+	}
+}
+
+// Block returns the longest time the commands of the pipeline may block on the server.
+// It returns a negative duration if a command blocks indefinitely.
+func (p *Pipeline) Block() time.Duration {
+	return p.block
+}
+
 var pipelinePool sync.Pool
 
 // BlankPipeline gets a blank pipeline from the pool
@@ -64,6 +163,7 @@ func BlankPipeline(db int64) (p *Pipeline) {
 func ReleasePipeline(p *Pipeline) {
 	if p != nil {
 		p.Reset()
+		p.RefThreshold = 0
 		pipelinePool.Put(p)
 	}
 
@@ -2,10 +2,14 @@ package redis
 
 import (
 	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"math"
 	"net"
 	"net/url"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -30,6 +34,30 @@ type Pool struct {
 	CheckIdleInterval time.Duration
 	DB                int
 	Dial              func(address string, timeout time.Duration) (net.Conn, error)
+	// TLSConfig enables TLS on every new connection if not nil.
+	// If Dial is also set, TLS is negotiated over the connections it returns.
+	TLSConfig *tls.Config
+	// Protocol is the RESP protocol version negotiated with HELLO on every new connection.
+	// If it is zero no HELLO command is sent.
+	Protocol   int
+	ClientName string
+	// Username and Password authenticate every new connection
+	Username string
+	Password string
+	// MaxRetries is the number of times a pipeline is retried after a network error
+	// or a LOADING, BUSY or TRYAGAIN server error (default 0, no retries)
+	MaxRetries int
+	// MinRetryBackoff is the delay before the first retry (default 8ms)
+	MinRetryBackoff time.Duration
+	// MaxRetryBackoff caps the delay between retries (default 512ms)
+	MaxRetryBackoff time.Duration
+	// RetryNonIdempotent allows retrying pipelines containing commands that are not idempotent
+	RetryNonIdempotent bool
+	// Scripts are loaded on every new connection if not nil
+	Scripts *ScriptRegistry
+	// Libraries are loaded with FUNCTION LOAD REPLACE on the first new connection.
+	// Set them only on pools connected to a master.
+	Libraries []*Library
 
 	numOpen int32
 	numIdle int32
@@ -43,17 +71,53 @@ type Pool struct {
 	ts        int64
 
 	hits, misses, timeouts int64
+	epoch                  int64 // incremented to invalidate open connections
+	librariesLoaded        int32
 }
 
 // Do executes a RESP pipeline
+//
+// Failed pipelines are retried up to MaxRetries times.
 func (pool *Pool) Do(p *Pipeline, r *resp.Reply) error {
-	conn, err := pool.Get()
+	return pool.DoContext(context.Background(), p, r)
+}
+
+// DoContext executes a RESP pipeline honoring the context deadline and cancellation
+//
+// Failed pipelines are retried up to MaxRetries times.
+func (pool *Pool) DoContext(ctx context.Context, p *Pipeline, r *resp.Reply) error {
+	var mark resp.Mark
+	if r != nil {
+		mark = r.Mark()
+	}
+	for attempt := 0; ; attempt++ {
+		sent, err := pool.do(ctx, p, r)
+		if attempt >= pool.MaxRetries || !pool.shouldRetry(p, r, mark, sent, err) {
+			return err
+		}
+		if err := sleepContext(ctx, pool.retryBackoff(attempt)); err != nil {
+			return err
+		}
+		if r != nil {
+			// Keep values read before this pipeline
+			r.Rewind(mark)
+		}
+	}
+}
+
+// do executes a pipeline once reporting if it was sent to the server
+func (pool *Pool) do(ctx context.Context, p *Pipeline, r *resp.Reply) (sent bool, err error) {
+	conn, err := pool.GetContext(ctx)
 	if err != nil {
-		return err
+		return false, err
+	}
+	if ctx.Done() == nil {
+		err = conn.Do(p, r)
+	} else {
+		err = conn.DoContext(ctx, p, r)
 	}
-	err = conn.Do(p, r)
 	pool.Put(conn)
-	return err
+	return true, err
 }
 
 // Close closes a pool
@@ -89,12 +153,20 @@ func (pool *Pool) Deadline() time.Time {
 
 // Get gets  a connection from the pool
 func (pool *Pool) Get() (*Conn, error) {
+	return pool.GetContext(context.Background())
+}
 
+// GetContext gets a connection from the pool.
+//
+// It stops waiting for an idle connection when the context is done.
+func (pool *Pool) GetContext(ctx context.Context) (*Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	for {
 		if n := atomic.LoadInt32(&pool.numIdle); n > 0 {
 			if atomic.CompareAndSwapInt32(&pool.numIdle, n, n-1) {
-				deadline := pool.Deadline()
-				return pool.get(deadline.UnixNano())
+				return pool.get(ctx)
 			}
 		} else if n < 0 {
 			return nil, errPoolClosed
@@ -106,7 +178,7 @@ func (pool *Pool) Get() (*Conn, error) {
 	for {
 		if n := atomic.LoadInt32(&pool.numOpen); 0 <= n && n < max {
 			if atomic.CompareAndSwapInt32(&pool.numOpen, n, n+1) {
-				conn, err := pool.dial()
+				conn, err := pool.dial(ctx)
 				if err != nil {
 					return nil, err
 				}
@@ -118,8 +190,7 @@ func (pool *Pool) Get() (*Conn, error) {
 			break
 		}
 	}
-	deadline := pool.Deadline()
-	return pool.get(deadline.UnixNano())
+	return pool.get(ctx)
 }
 
 // Put releases a connection to the pool
@@ -128,7 +199,7 @@ func (pool *Pool) Put(c *Conn) {
 		return
 	}
 
-	if c.err != nil {
+	if c.err != nil || c.epoch != atomic.LoadInt64(&pool.epoch) {
 		pool.closeConn(c)
 		return
 	}
@@ -142,10 +213,23 @@ func (pool *Pool) Put(c *Conn) {
 }
 
 func defaultDial(addr string, timeout time.Duration) (net.Conn, error) {
-	if addr == "" {
-		addr = ":6379"
+	network, addr := splitNetworkAddress(addr)
+	return net.DialTimeout(network, addr, timeout)
+}
+
+// splitNetworkAddress selects the network for an address.
+// Addresses of the form unix:/path/to/socket or plain absolute paths select a unix domain socket.
+func splitNetworkAddress(addr string) (network, address string) {
+	switch {
+	case addr == "":
+		return "tcp", ":6379"
+	case strings.HasPrefix(addr, "unix:"):
+		return "unix", strings.TrimPrefix(addr, "unix:")
+	case strings.HasPrefix(addr, "/"):
+		return "unix", addr
+	default:
+		return "tcp", addr
 	}
-	return net.DialTimeout("tcp", addr, timeout)
 }
 
 type noCopy struct{}
@@ -173,24 +257,12 @@ func (pool *Pool) clean(scratch *[]*Conn, now time.Time) (int, error) {
 		return 0, nil
 	}
 	*scratch = append((*scratch)[:0], idle[:i]...)
-	// Decrement active count while under lock
-	pool.active -= i
-	j := copy(pool.idle, idle[i:])
-	if len(pool.idle) > j {
-		for i := range pool.idle[j:] {
-			pool.idle[i] = nil
-		}
-		pool.idle = pool.idle[:j]
-	}
-	if len(pool.idle) == 0 {
-		pool.cond.L = nil
-	}
-
+	j := pool.removeIdle(i)
 	pool.mu.Unlock()
 	atomic.StoreInt32(&pool.numIdle, int32(j))
 	tmp := *scratch
 	for i, c := range tmp {
-		c.Close()
+		pool.closeConn(c)
 		tmp[i] = nil
 	}
 	n := len(tmp)
@@ -198,6 +270,38 @@ func (pool *Pool) clean(scratch *[]*Conn, now time.Time) (int, error) {
 	return n, nil
 }
 
+// removeIdle removes the n oldest idle connections while under lock
+func (pool *Pool) removeIdle(n int) int {
+	// Decrement active count while under lock
+	pool.active -= n
+	idle := pool.idle
+	j := copy(idle, idle[n:])
+	for i := range idle[j:] {
+		idle[j+i] = nil
+	}
+	pool.idle = idle[:j]
+	return j
+}
+
+// Invalidate closes all idle connections.
+// Connections currently in use are closed when they are released to the pool.
+func (pool *Pool) Invalidate() int {
+	atomic.AddInt64(&pool.epoch, 1)
+	pool.mu.Lock()
+	if pool.closed {
+		pool.mu.Unlock()
+		return 0
+	}
+	stale := append([]*Conn(nil), pool.idle...)
+	j := pool.removeIdle(len(pool.idle))
+	pool.mu.Unlock()
+	atomic.StoreInt32(&pool.numIdle, int32(j))
+	for _, c := range stale {
+		pool.closeConn(c)
+	}
+	return len(stale)
+}
+
 // const poolClockInterval = 100 * time.Millisecond
 
 func (pool *Pool) newConn(conn net.Conn) (c *Conn) {
@@ -214,37 +318,96 @@ func (pool *Pool) newConn(conn net.Conn) (c *Conn) {
 		c = x.(*Conn)
 		c.r.Reset(c)
 	}
-	c.options = &ConnOptions{
-		ReadBufferSize: pool.ReadBufferSize,
-		ReadTimeout:    pool.ReadTimeout,
-		WriteTimeout:   pool.WriteTimeout,
-	}
+	options := pool.connOptions()
+	c.options = &options
 	c.conn = conn
+	c.info = ServerInfo{}
+	c.epoch = atomic.LoadInt64(&pool.epoch)
 	c.createdAt = now
 	c.lastUsedAt = now
 	c.Select(int64(pool.DB))
 	return
 }
 
+func (pool *Pool) connOptions() ConnOptions {
+	return ConnOptions{
+		ReadBufferSize: pool.ReadBufferSize,
+		ReadTimeout:    pool.ReadTimeout,
+		WriteTimeout:   pool.WriteTimeout,
+		Protocol:       pool.Protocol,
+		ClientName:     pool.ClientName,
+		Username:       pool.Username,
+		Password:       pool.Password,
+	}
+}
+
 // Pipeline gets a blank pipeline from the pool setting the correct DB
 func (pool *Pool) Pipeline() *Pipeline {
 	return BlankPipeline(int64(pool.DB))
 }
 
-func (pool *Pool) dial() (*Conn, error) {
+func (pool *Pool) dial(ctx context.Context) (*Conn, error) {
+	c, err := pool.open(ctx)
+	if err != nil {
+		atomic.AddInt32(&pool.numOpen, -1)
+		return nil, err
+	}
+	return c, nil
+}
+
+// open opens a new connection loading registered scripts and libraries
+func (pool *Pool) open(ctx context.Context) (*Conn, error) {
+	c, err := pool.connect(ctx)
+	if err == nil && pool.Scripts != nil {
+		if err = pool.Scripts.load(ctx, c); err != nil {
+			c.Close()
+		}
+	}
+	if err == nil {
+		if err = pool.loadLibraries(ctx, c); err != nil {
+			c.Close()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// connect opens a new connection without adding it to the pool
+func (pool *Pool) connect(ctx context.Context) (*Conn, error) {
 	dialer := pool.Dial
 	if dialer == nil {
 		dialer = defaultDial
 	}
-	conn, err := dialer(pool.Address, pool.WaitTimeout)
+	timeout := pool.WaitTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		if d := time.Until(deadline); timeout <= 0 || d < timeout {
+			timeout = d
+		}
+		if timeout <= 0 {
+			return nil, context.DeadlineExceeded
+		}
+	}
+	conn, err := dialer(pool.Address, timeout)
+	if err == nil && pool.TLSConfig != nil {
+		if timeout <= 0 {
+			timeout = defaultTLSHandshakeTimeout
+		}
+		conn, err = clientTLS(conn, pool.Address, pool.TLSConfig, timeout)
+	}
 	if err != nil {
-		atomic.AddInt32(&pool.numOpen, -1)
 		return nil, err
 	}
-	return pool.newConn(conn), nil
+	c := pool.newConn(conn)
+	if err := c.withContext(ctx, c.handshake); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
 }
 
-func (pool *Pool) runCleaner() {
+func (pool *Pool) runCleaner(done <-chan struct{}) {
 	interval := pool.CheckIdleInterval
 	if interval < time.Second {
 		interval = time.Second
@@ -254,7 +417,7 @@ func (pool *Pool) runCleaner() {
 	defer tick.Stop()
 	for {
 		select {
-		case <-pool.closeChan:
+		case <-done:
 			tick.Stop()
 			return
 		case t := <-tick.C:
@@ -286,7 +449,7 @@ func (pool *Pool) closeConn(c *Conn) {
 }
 
 func (pool *Pool) put(c *Conn) {
-	run := false
+	var run chan struct{}
 	ts := c.lastUsedAt.UnixNano()
 	isNew := c.lastUsedAt.Equal(c.createdAt)
 	pool.mu.Lock()
@@ -303,7 +466,7 @@ func (pool *Pool) put(c *Conn) {
 	pool.idle = append(pool.idle, c)
 	if pool.closeChan == nil {
 		pool.closeChan = make(chan struct{})
-		run = true
+		run = pool.closeChan
 	}
 	if pool.cond.L == nil {
 		pool.cond.L = &pool.mu
@@ -311,14 +474,27 @@ func (pool *Pool) put(c *Conn) {
 	pool.cond.Signal()
 	pool.mu.Unlock()
 	atomic.AddInt32(&pool.numIdle, 1)
-	if run {
-		go pool.runCleaner()
+	if run != nil {
+		go pool.runCleaner(run)
 	}
 }
 
-func (pool *Pool) get(deadline int64) (conn *Conn, err error) {
+func (pool *Pool) get(ctx context.Context) (conn *Conn, err error) {
 	miss := false
+	parent := ctx
 	pool.mu.Lock()
+	if len(pool.idle) == 0 && !pool.closed {
+		// Wake up waiters when the context is done or the wait deadline passes
+		waitCtx, cancel := context.WithDeadline(ctx, pool.Deadline())
+		defer cancel()
+		ctx = waitCtx
+		go func() {
+			<-waitCtx.Done()
+			pool.mu.Lock()
+			pool.cond.Broadcast()
+			pool.mu.Unlock()
+		}()
+	}
 	for len(pool.idle) == 0 {
 		miss = true
 		if pool.closed {
@@ -326,10 +502,21 @@ func (pool *Pool) get(deadline int64) (conn *Conn, err error) {
 			err = errPoolClosed
 			return
 		}
-		if 0 < deadline && deadline < pool.ts {
+		if ctxErr := ctx.Err(); ctxErr != nil {
 			pool.mu.Unlock()
-			atomic.AddInt64(&pool.timeouts, 1)
-			err = errDeadlineExceeded
+			if ctxErr == context.DeadlineExceeded {
+				atomic.AddInt64(&pool.timeouts, 1)
+			}
+			err = parent.Err()
+			if err == nil {
+				if deadline, ok := parent.Deadline(); ok && !time.Now().Before(deadline) {
+					// The wait deadline is the caller's deadline
+					err = context.DeadlineExceeded
+				} else {
+					// Only the pool WaitTimeout has passed
+					err = errDeadlineExceeded
+				}
+			}
 			return
 		}
 		if pool.cond.L == nil {
@@ -377,25 +564,61 @@ func (pool *Pool) ParseURL(rawurl string) (err error) {
 	if err != nil {
 		return
 	}
-	if u.Scheme != "redis" {
+	q := u.Query()
+	switch u.Scheme {
+	case "redis", "rediss":
+		if path := strings.Trim(u.Path, "/"); path != "" {
+			n, err := strconv.ParseInt(path, 10, 32)
+			if err != nil || n < 0 {
+				return fmt.Errorf(`Invalid URL path %q`, u.Path)
+			}
+			pool.DB = int(n)
+		}
+		host, port := u.Hostname(), u.Port()
+		if port == "" {
+			port = "6379"
+		}
+		pool.Address = host + ":" + port
+		if u.Scheme == "rediss" {
+			pool.TLSConfig, err = parseTLSConfig(host, q)
+			if err != nil {
+				return
+			}
+		} else {
+			pool.TLSConfig = nil
+		}
+	case "unix", "redis+unix":
+		path := u.Path
+		if path == "" {
+			path = u.Opaque
+		}
+		if path == "" {
+			return fmt.Errorf(`Invalid URL socket path %q`, rawurl)
+		}
+		pool.Address = "unix:" + path
+		pool.TLSConfig = nil
+		if v, ok := q["db"]; ok && len(v) > 0 {
+			n, err := strconv.ParseInt(v[0], 10, 32)
+			if err != nil || n < 0 {
+				return fmt.Errorf(`Invalid URL db %q`, v[0])
+			}
+			pool.DB = int(n)
+		}
+	default:
 		err = fmt.Errorf(`Invalid URL scheme %q`, u.Scheme)
 		return
 	}
 
-	if path := strings.Trim(u.Path, "/"); path != "" {
-		n, err := strconv.ParseInt(path, 10, 32)
-		if err != nil || n < 0 {
-			return fmt.Errorf(`Invalid URL path %q`, u.Path)
-		}
-		pool.DB = int(n)
+	if u.User != nil {
+		pool.Username = u.User.Username()
+		pool.Password, _ = u.User.Password()
 	}
-
-	q := u.Query()
-	host, port := u.Hostname(), u.Port()
-	if port == "" {
-		port = "6379"
+	if v, ok := q["username"]; ok && len(v) > 0 {
+		pool.Username = v[0]
+	}
+	if v, ok := q["password"]; ok && len(v) > 0 {
+		pool.Password = v[0]
 	}
-	pool.Address = host + ":" + port
 
 	if v, ok := q["read-timeout"]; ok && len(v) > 0 {
 		if d, _ := time.ParseDuration(v[0]); d > 0 {
@@ -418,6 +641,15 @@ func (pool *Pool) ParseURL(rawurl string) (err error) {
 		}
 	}
 
+	if v, ok := q["protocol"]; ok && len(v) > 0 {
+		if proto, _ := strconv.Atoi(v[0]); proto > 0 {
+			pool.Protocol = proto
+		}
+	}
+	if v, ok := q["client-name"]; ok && len(v) > 0 {
+		pool.ClientName = v[0]
+	}
+
 	if v, ok := q["max-conn-age"]; ok && len(v) > 0 {
 		if d, _ := time.ParseDuration(v[0]); d > 0 {
 			pool.MaxConnectionAge = d
@@ -437,6 +669,41 @@ func (pool *Pool) ParseURL(rawurl string) (err error) {
 	return
 }
 
+func parseTLSConfig(host string, q url.Values) (*tls.Config, error) {
+	config := tls.Config{
+		ServerName: host,
+	}
+	if v, ok := q["tls-server-name"]; ok && len(v) > 0 {
+		config.ServerName = v[0]
+	}
+	if v, ok := q["tls-insecure-skip-verify"]; ok && len(v) > 0 {
+		skip, err := strconv.ParseBool(v[0])
+		if err != nil {
+			return nil, fmt.Errorf(`Invalid tls-insecure-skip-verify %q`, v[0])
+		}
+		config.InsecureSkipVerify = skip
+	}
+	if v, ok := q["tls-ca-file"]; ok && len(v) > 0 {
+		data, err := os.ReadFile(v[0])
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf(`Invalid tls-ca-file %q`, v[0])
+		}
+	}
+	certFile, keyFile := q.Get("tls-cert-file"), q.Get("tls-key-file")
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return &config, nil
+}
+
 // Idle returns the number of idle connections
 func (pool *Pool) Idle() int {
 	return int(atomic.LoadInt32(&pool.numIdle))
@@ -0,0 +1,376 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+// Message is a message received by a subscriber
+type Message struct {
+	Pattern string
+	Channel string
+	Payload []byte
+}
+
+// PubSub is a Publish/Subscribe client.
+//
+// It keeps track of channel and pattern subscriptions and re-subscribes
+// to all of them whenever the connection is re-established.
+type PubSub struct {
+	// Dial opens a new connection for the subscriber
+	Dial func(ctx context.Context) (*Conn, error)
+	// PingInterval is the interval between keepalive pings (default 30s).
+	// If no reply is received for a whole interval the connection is re-established.
+	PingInterval time.Duration
+	// ReconnectBackoff is the time to wait between reconnect attempts (default 1s)
+	ReconnectBackoff time.Duration
+
+	mu       sync.Mutex
+	conn     net.Conn
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	closed   bool
+	done     chan struct{}
+}
+
+// PubSub creates a subscriber using connections to the pool address.
+//
+// Subscriber connections are not counted towards MaxConnections.
+func (pool *Pool) PubSub() *PubSub {
+	return &PubSub{
+		Dial: pool.connect,
+	}
+}
+
+// ErrPubSubClosed occurs when a PubSub is used after Close()
+const ErrPubSubClosed = Err("PubSub closed")
+
+const (
+	defaultPingInterval     = 30 * time.Second
+	defaultReconnectBackoff = time.Second
+)
+
+// Subscribe subscribes to channels
+func (ps *PubSub) Subscribe(channels ...string) error {
+	return ps.subscribe("SUBSCRIBE", channels)
+}
+
+// PSubscribe subscribes to channel patterns
+func (ps *PubSub) PSubscribe(patterns ...string) error {
+	return ps.subscribe("PSUBSCRIBE", patterns)
+}
+
+// Unsubscribe unsubscribes from channels or from all channels if none is given
+func (ps *PubSub) Unsubscribe(channels ...string) error {
+	return ps.subscribe("UNSUBSCRIBE", channels)
+}
+
+// PUnsubscribe unsubscribes from channel patterns or from all patterns if none is given
+func (ps *PubSub) PUnsubscribe(patterns ...string) error {
+	return ps.subscribe("PUNSUBSCRIBE", patterns)
+}
+
+func (ps *PubSub) subscribe(cmd string, names []string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.closed {
+		return ErrPubSubClosed
+	}
+	switch cmd {
+	case "SUBSCRIBE":
+		if ps.channels == nil {
+			ps.channels = make(map[string]struct{}, len(names))
+		}
+		for _, name := range names {
+			ps.channels[name] = struct{}{}
+		}
+	case "PSUBSCRIBE":
+		if ps.patterns == nil {
+			ps.patterns = make(map[string]struct{}, len(names))
+		}
+		for _, name := range names {
+			ps.patterns[name] = struct{}{}
+		}
+	case "UNSUBSCRIBE":
+		for _, name := range names {
+			delete(ps.channels, name)
+		}
+		if len(names) == 0 {
+			ps.channels = nil
+		}
+	case "PUNSUBSCRIBE":
+		for _, name := range names {
+			delete(ps.patterns, name)
+		}
+		if len(names) == 0 {
+			ps.patterns = nil
+		}
+	}
+	if ps.conn == nil {
+		// Subscriptions are sent once connected
+		return nil
+	}
+	p := BlankPipeline(-1)
+	defer ReleasePipeline(p)
+	p.Command(cmd, len(names))
+	for _, name := range names {
+		p.Arg(resp.String(name))
+	}
+	return ps.write(p)
+}
+
+// write writes a pipeline to the subscriber connection while holding the lock
+func (ps *PubSub) write(p *Pipeline) error {
+	if ps.conn == nil {
+		return errConnClosed
+	}
+	ps.conn.SetWriteDeadline(time.Now().Add(ps.pingInterval()))
+	if _, err := ps.conn.Write(p.B); err != nil {
+		ps.conn.Close()
+		return err
+	}
+	return nil
+}
+
+func (ps *PubSub) pingInterval() time.Duration {
+	if ps.PingInterval > 0 {
+		return ps.PingInterval
+	}
+	return defaultPingInterval
+}
+
+// Close closes the subscriber stopping Run
+func (ps *PubSub) Close() error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.closed {
+		return ErrPubSubClosed
+	}
+	ps.closed = true
+	if ps.done != nil {
+		close(ps.done)
+	}
+	if ps.conn != nil {
+		ps.conn.Close()
+		ps.conn = nil
+	}
+	return nil
+}
+
+// Channel starts receiving messages in a new goroutine and delivers them to a channel.
+//
+// The channel is closed when the context is done or the subscriber is closed.
+func (ps *PubSub) Channel(ctx context.Context, size int) <-chan *Message {
+	ch := make(chan *Message, size)
+	go func() {
+		defer close(ch)
+		done := ps.closing()
+		ps.Run(ctx, func(m *Message) {
+			msg := Message{
+				Pattern: m.Pattern,
+				Channel: m.Channel,
+				Payload: append([]byte(nil), m.Payload...),
+			}
+			select {
+			case ch <- &msg:
+			case <-ctx.Done():
+			case <-done:
+			}
+		})
+	}()
+	return ch
+}
+
+// closing returns a channel closed when the subscriber is closed
+func (ps *PubSub) closing() <-chan struct{} {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.doneLocked()
+}
+
+func (ps *PubSub) doneLocked() chan struct{} {
+	if ps.done == nil {
+		ps.done = make(chan struct{})
+		if ps.closed {
+			close(ps.done)
+		}
+	}
+	return ps.done
+}
+
+// Run receives messages calling fn for each one until the context is done or the subscriber is closed.
+//
+// The message passed to fn is only valid until fn returns.
+// Connection errors are handled by reconnecting and subscribing again to all channels and patterns.
+func (ps *PubSub) Run(ctx context.Context, fn func(m *Message)) error {
+	ps.mu.Lock()
+	if ps.closed {
+		ps.mu.Unlock()
+		return ErrPubSubClosed
+	}
+	done := ps.doneLocked()
+	ps.mu.Unlock()
+
+	backoff := ps.ReconnectBackoff
+	if backoff <= 0 {
+		backoff = defaultReconnectBackoff
+	}
+	for {
+		conn, err := ps.connect(ctx)
+		if err == nil {
+			ps.receive(ctx, conn, fn)
+			conn.Close()
+		}
+		select {
+		case <-done:
+			return ErrPubSubClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// connect dials a new connection and subscribes to all channels and patterns
+func (ps *PubSub) connect(ctx context.Context) (*Conn, error) {
+	dial := ps.Dial
+	if dial == nil {
+		dial = func(context.Context) (*Conn, error) {
+			return Dial("", ConnOptions{})
+		}
+	}
+	conn, err := dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Subscriber connections block on reads until a message arrives
+	conn.options.ReadTimeout = 0
+	conn.conn.SetReadDeadline(time.Time{})
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.closed {
+		conn.Close()
+		return nil, ErrPubSubClosed
+	}
+	p := BlankPipeline(-1)
+	defer ReleasePipeline(p)
+	if len(ps.channels) > 0 {
+		p.Command("SUBSCRIBE", len(ps.channels))
+		for ch := range ps.channels {
+			p.Arg(resp.String(ch))
+		}
+	}
+	if len(ps.patterns) > 0 {
+		p.Command("PSUBSCRIBE", len(ps.patterns))
+		for pattern := range ps.patterns {
+			p.Arg(resp.String(pattern))
+		}
+	}
+	ps.conn = conn.conn
+	if p.Len() > 0 {
+		if err := ps.write(p); err != nil {
+			ps.conn = nil
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// receive reads messages from a subscribed connection until an error occurs
+func (ps *PubSub) receive(ctx context.Context, conn *Conn, fn func(m *Message)) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	pong := make(chan struct{}, 1)
+	go ps.keepalive(ctx, conn.conn, pong, stop)
+	defer func() {
+		ps.mu.Lock()
+		if ps.conn == conn.conn {
+			ps.conn = nil
+		}
+		ps.mu.Unlock()
+	}()
+
+	reply := BlankReply()
+	defer ReleaseReply(reply)
+	msg := Message{}
+	for {
+		reply.Reset()
+		v, err := reply.ReadFrom(conn.r)
+		if err != nil {
+			return err
+		}
+		// Any reply means the connection is alive
+		select {
+		case pong <- struct{}{}:
+		default:
+		}
+		if !parseMessage(v, &msg) {
+			continue
+		}
+		if fn != nil {
+			fn(&msg)
+		}
+	}
+}
+
+// keepalive pings the server and closes the connection if no reply arrives for a whole interval
+func (ps *PubSub) keepalive(ctx context.Context, conn net.Conn, pong <-chan struct{}, stop <-chan struct{}) {
+	interval := ps.pingInterval()
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	p := BlankPipeline(-1)
+	defer ReleasePipeline(p)
+	p.Ping("")
+	alive := true
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			conn.Close()
+			return
+		case <-pong:
+			alive = true
+		case <-tick.C:
+			if !alive {
+				conn.Close()
+				return
+			}
+			alive = false
+			ps.mu.Lock()
+			if ps.conn == conn {
+				ps.write(p)
+			}
+			ps.mu.Unlock()
+		}
+	}
+}
+
+// parseMessage parses a message or pmessage reply
+func parseMessage(v resp.Value, msg *Message) bool {
+	switch v.Type() {
+	case resp.Array, resp.Push:
+	default:
+		return false
+	}
+	switch string(v.Get(0).Bytes()) {
+	case "message":
+		msg.Pattern = ""
+		msg.Channel = string(v.Get(1).Bytes())
+		msg.Payload = v.Get(2).Bytes()
+		return true
+	case "pmessage":
+		msg.Pattern = string(v.Get(1).Bytes())
+		msg.Channel = string(v.Get(2).Bytes())
+		msg.Payload = v.Get(3).Bytes()
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,107 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+func TestPubSub(t *testing.T) {
+	dials := make(chan net.Conn, 2)
+	ps := PubSub{
+		Dial: func(ctx context.Context) (*Conn, error) {
+			client, server := net.Pipe()
+			dials <- server
+			return newConn(client, ConnOptions{}), nil
+		},
+		ReconnectBackoff: time.Millisecond,
+	}
+	defer ps.Close()
+	if err := ps.Subscribe("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.PSubscribe("bar.*"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ch := ps.Channel(ctx, 1)
+	serve := func(server net.Conn, payload string) {
+		buf := make([]byte, 4096)
+		n, _ := server.Read(buf)
+		if v, err := resp.ParseValue(buf[:n]); err != nil || string(v.Get(0).Bytes()) != "SUBSCRIBE" {
+			t.Errorf("Invalid subscribe command %q", buf[:n])
+		}
+		b := resp.Buffer{}
+		b.BulkStringArray("pmessage", "bar.*", "bar.baz", payload)
+		server.Write(b.B)
+	}
+	// First connection delivers a message and is dropped
+	server := <-dials
+	go func() {
+		serve(server, "hello")
+		server.Close()
+	}()
+	if m := <-ch; m == nil || m.Pattern != "bar.*" || m.Channel != "bar.baz" || string(m.Payload) != "hello" {
+		t.Fatalf("Invalid message %v", m)
+	}
+	// Subscriptions are restored after reconnecting
+	server = <-dials
+	go serve(server, "again")
+	if m := <-ch; m == nil || string(m.Payload) != "again" {
+		t.Fatalf("Invalid message %v", m)
+	}
+}
+
+// readErrConn reports the first failed read
+type readErrConn struct {
+	net.Conn
+	once    sync.Once
+	readErr chan struct{}
+}
+
+func (c *readErrConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if err != nil {
+		c.once.Do(func() { close(c.readErr) })
+	}
+	return n, err
+}
+
+func TestPubSub_ChannelClose(t *testing.T) {
+	s := &fakeServer{
+		handle:     func(args []string, w *resp.Buffer) {},
+		subscribed: make(chan struct{}, 1),
+	}
+	nc, _ := s.Dial("", 0)
+	rc := &readErrConn{Conn: nc, readErr: make(chan struct{})}
+	ps := PubSub{
+		Dial: func(ctx context.Context) (*Conn, error) {
+			return newConn(rc, ConnOptions{}), nil
+		},
+	}
+	if err := ps.Subscribe("foo"); err != nil {
+		t.Fatal(err)
+	}
+	ch := ps.Channel(context.Background(), 0)
+	<-s.subscribed
+	s.publish("foo", "hello")
+	<-ch
+	// The in-memory connection returns once the client has read the message.
+	// Nobody receives so its delivery blocks until the subscriber is closed.
+	s.publish("foo", "hello")
+	ps.Close()
+	// Reading resumes only after the blocked delivery is abandoned
+	select {
+	case <-rc.readErr:
+	case <-time.After(time.Second):
+		t.Fatal("Delivery still blocked after close")
+	}
+	if m, ok := <-ch; ok {
+		t.Errorf("Message delivered after close %v", m)
+	}
+}
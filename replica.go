@@ -0,0 +1,163 @@
+package redis
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+// ReplicaPolicy selects the replica serving a read-only pipeline
+type ReplicaPolicy int
+
+// Replica selection policies
+const (
+	// RoundRobin cycles through replicas
+	RoundRobin ReplicaPolicy = iota
+	// LowestLatency selects the replica with the lowest average response time.
+	// One in every 16 pipelines is sent to the replicas in turn to keep the averages of slower ones current.
+	LowestLatency
+	// Random selects a random replica
+	Random
+)
+
+// ReplicatedPool splits reads and writes between a master and its replicas.
+//
+// Pipelines containing only read-only commands are sent to a replica selected by Policy.
+// All other pipelines are sent to the master.
+// If a replica fails with a network error the pipeline is retried on the master.
+type ReplicatedPool struct {
+	noCopy
+
+	Master *Pool
+	// Replicas should not be modified after the first call to Do
+	Replicas []*Pool
+	Policy   ReplicaPolicy
+
+	once    sync.Once
+	next    uint32
+	latency []int64 // moving average of response time for each replica in nanoseconds
+}
+
+// replicaErrorPenalty is added to the latency of a replica that failed
+const replicaErrorPenalty = time.Second
+
+// replicaProbeInterval is the number of pipelines between probes of replicas that are not the fastest
+const replicaProbeInterval = 16
+
+// Do executes a pipeline on the master or on a replica if it contains only read-only commands
+func (rp *ReplicatedPool) Do(p *Pipeline, r *resp.Reply) error {
+	return rp.DoContext(context.Background(), p, r)
+}
+
+// DoContext executes a pipeline on the master or on a replica honoring the context deadline and cancellation
+func (rp *ReplicatedPool) DoContext(ctx context.Context, p *Pipeline, r *resp.Reply) error {
+	if !p.IsReadOnly() {
+		return rp.Master.DoContext(ctx, p, r)
+	}
+	return rp.DoReadOnly(ctx, p, r)
+}
+
+// DoReadOnly executes a pipeline on a replica regardless of the commands it contains.
+//
+// It falls back to the master if there are no replicas or the replica fails with a network error.
+func (rp *ReplicatedPool) DoReadOnly(ctx context.Context, p *Pipeline, r *resp.Reply) error {
+	i := rp.replica()
+	if i == -1 {
+		return rp.Master.DoContext(ctx, p, r)
+	}
+	var mark resp.Mark
+	if r != nil {
+		mark = r.Mark()
+	}
+	start := time.Now()
+	err := rp.Replicas[i].DoContext(ctx, p, r)
+	elapsed := time.Since(start)
+	if err == nil {
+		rp.observe(i, elapsed)
+		return nil
+	}
+	rp.observe(i, elapsed+replicaErrorPenalty)
+	if ctx.Err() != nil {
+		return err
+	}
+	if r != nil {
+		r.Rewind(mark)
+	}
+	return rp.Master.DoContext(ctx, p, r)
+}
+
+// Close closes the master and all replica pools
+func (rp *ReplicatedPool) Close() error {
+	err := rp.Master.Close()
+	for _, pool := range rp.Replicas {
+		if e := pool.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// replica returns the index of the replica selected by the policy or -1 if there are no replicas
+func (rp *ReplicatedPool) replica() int {
+	n := len(rp.Replicas)
+	if n == 0 {
+		return -1
+	}
+	switch rp.Policy {
+	case Random:
+		return rand.Intn(n)
+	case LowestLatency:
+		rp.once.Do(rp.init)
+		if k := atomic.AddUint32(&rp.next, 1); k%replicaProbeInterval == 0 {
+			// Failed replicas recover once probes lower their average
+			return int(k/replicaProbeInterval) % n
+		}
+		min, best := int64(-1), 0
+		for i := range rp.latency {
+			d := atomic.LoadInt64(&rp.latency[i])
+			if d == 0 {
+				// Try replicas without measurements first
+				return i
+			}
+			if min == -1 || d < min {
+				min, best = d, i
+			}
+		}
+		return best
+	default:
+		return int(atomic.AddUint32(&rp.next, 1)-1) % n
+	}
+}
+
+func (rp *ReplicatedPool) init() {
+	rp.latency = make([]int64, len(rp.Replicas))
+}
+
+// observe updates the moving average of a replica's response time
+func (rp *ReplicatedPool) observe(i int, d time.Duration) {
+	if rp.Policy != LowestLatency {
+		return
+	}
+	rp.once.Do(rp.init)
+	if i >= len(rp.latency) {
+		return
+	}
+	addr := &rp.latency[i]
+	for {
+		old := atomic.LoadInt64(addr)
+		avg := int64(d)
+		if old != 0 {
+			avg = old - old/8 + avg/8
+		}
+		if avg <= 0 {
+			avg = 1
+		}
+		if atomic.CompareAndSwapInt64(addr, old, avg) {
+			return
+		}
+	}
+}
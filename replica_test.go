@@ -0,0 +1,135 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+func TestReplicatedPool_Do(t *testing.T) {
+	newPool := func(name string) *Pool {
+		s := &fakeServer{
+			handle: func(args []string, w *resp.Buffer) {
+				w.BulkString(name)
+			},
+		}
+		return &Pool{Dial: s.Dial}
+	}
+	rp := ReplicatedPool{
+		Master:   newPool("master"),
+		Replicas: []*Pool{newPool("r0"), newPool("r1")},
+	}
+	defer rp.Close()
+	do := func(fn func(p *Pipeline)) string {
+		p := BlankPipeline(0)
+		defer ReleasePipeline(p)
+		fn(p)
+		r := BlankReply()
+		defer ReleaseReply(r)
+		if err := rp.Do(p, r); err != nil {
+			t.Fatal(err)
+		}
+		return string(r.Value().Get(0).Bytes())
+	}
+	get := func(p *Pipeline) {
+		p.Get("foo")
+		p.HGetAll("bar")
+	}
+	if name := do(get); name != "r0" {
+		t.Errorf("Invalid pool %q", name)
+	}
+	if name := do(get); name != "r1" {
+		t.Errorf("Invalid pool %q", name)
+	}
+	set := func(p *Pipeline) {
+		p.Get("foo")
+		p.Set("foo", resp.String("bar"), 0)
+	}
+	if name := do(set); name != "master" {
+		t.Errorf("Invalid pool %q", name)
+	}
+	rp.Policy = LowestLatency
+	if name := do(get); name != "r0" && name != "r1" {
+		t.Errorf("Invalid pool %q", name)
+	}
+}
+
+func TestPipeline_IsReadOnly(t *testing.T) {
+	p := BlankPipeline(2)
+	defer ReleasePipeline(p)
+	if p.IsReadOnly() {
+		t.Errorf("Empty pipeline is read-only")
+	}
+	p.MGet("foo", "bar")
+	p.ZRangeByScore("baz", 0, 1, false, 0, 0)
+	if !p.IsReadOnly() {
+		t.Errorf("Pipeline is not read-only")
+	}
+	p.Incr("foo")
+	if p.IsReadOnly() {
+		t.Errorf("Pipeline is read-only")
+	}
+}
+
+func TestReplicatedPool_DoReadOnlyFallback(t *testing.T) {
+	replica := &fakeServer{
+		handle: func(args []string, w *resp.Buffer) {
+			if args[0] == "HGETALL" {
+				time.Sleep(50 * time.Millisecond)
+			}
+			w.BulkString("replica")
+		},
+	}
+	master := &fakeServer{
+		handle: func(args []string, w *resp.Buffer) {
+			w.BulkString(args[0])
+		},
+	}
+	rp := ReplicatedPool{
+		Master:   &Pool{Dial: master.Dial},
+		Replicas: []*Pool{{Dial: replica.Dial, ReadTimeout: 10 * time.Millisecond}},
+	}
+	defer rp.Close()
+	p := BlankPipeline(0)
+	defer ReleasePipeline(p)
+	r := BlankReply()
+	defer ReleaseReply(r)
+	p.Set("foo", resp.String("bar"), 0)
+	if err := rp.Do(p, r); err != nil {
+		t.Fatal(err)
+	}
+	// The replica times out after its first reply and the master replies instead
+	p.Reset()
+	p.Get("foo")
+	p.HGetAll("bar")
+	if err := rp.Do(p, r); err != nil {
+		t.Fatal(err)
+	}
+	if v := string(r.Value().Get(0).Bytes()); v != "SET" {
+		t.Errorf("Invalid earlier reply %q", v)
+	}
+}
+
+func TestReplicatedPool_LowestLatencyProbe(t *testing.T) {
+	rp := ReplicatedPool{
+		Replicas: []*Pool{{}, {}},
+		Policy:   LowestLatency,
+	}
+	rp.observe(0, replicaErrorPenalty)
+	rp.observe(1, time.Millisecond)
+	picks := make([]int, 2)
+	for i := 0; i < 4*replicaProbeInterval; i++ {
+		picks[rp.replica()]++
+	}
+	if picks[0] == 0 || picks[0] > picks[1] {
+		t.Errorf("Invalid picks %v", picks)
+	}
+	// Probes lower the average of a replica once it recovers
+	for i := 0; i < 100; i++ {
+		rp.observe(0, 100*time.Microsecond)
+	}
+	if i := rp.replica(); i != 0 {
+		t.Errorf("Invalid replica %d", i)
+	}
+}
@@ -1,7 +1,10 @@
 package resp
 
 import (
+	"encoding"
+	"io"
 	"math"
+	"time"
 )
 
 type argType uint
@@ -16,6 +19,8 @@ const (
 	typFloat
 	typTrue
 	typFalse
+	typAppender
+	typReader
 )
 
 // Arg is a RESP command argument
@@ -24,6 +29,73 @@ type Arg struct {
 	str string
 	buf []byte
 	num uint64
+	app ArgAppender
+	rd  io.Reader
+}
+
+// ArgAppender is implemented by types that encode themselves as command arguments.
+//
+// AppendArg appends the argument to buf as a RESP bulk string.
+// Use AppendBulkString to add the framing around the encoded value.
+// The name differs from AppendRESP of Value and Buffer which append values that are not bulk strings.
+type ArgAppender interface {
+	AppendArg(buf []byte) []byte
+}
+
+// AppendBulkString appends data to buf as a RESP bulk string
+func AppendBulkString(buf []byte, data []byte) []byte {
+	return appendBulkStringRaw(buf, data)
+}
+
+// Appender creates an argument encoded by an ArgAppender.
+//
+// A nil appender is encoded as a null bulk string.
+func Appender(a ArgAppender) Arg {
+	return Arg{typ: typAppender, app: a}
+}
+
+// Reader creates an argument streamed from a reader when the buffer is written.
+//
+// Exactly size bytes are copied from the reader without buffering them.
+// A nil reader or a negative size is encoded as a null bulk string.
+func Reader(r io.Reader, size int64) Arg {
+	if r == nil || size < 0 {
+		return Arg{}
+	}
+	return Arg{typ: typReader, rd: r, num: uint64(size)}
+}
+
+// Binary creates a byte slice argument from the binary encoding of a value.
+func Binary(m encoding.BinaryMarshaler) (Arg, error) {
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return Arg{}, err
+	}
+	return Raw(data), nil
+}
+
+// Time creates an int argument with a UNIX timestamp in the given unit.
+//
+// A zero or negative unit is treated as a second.
+func Time(t time.Time, unit time.Duration) Arg {
+	switch {
+	case unit <= 0, unit == time.Second:
+		return Int(t.Unix())
+	case unit%time.Second == 0:
+		return Int(t.Unix() / int64(unit/time.Second))
+	default:
+		return Int(t.UnixNano() / int64(unit))
+	}
+}
+
+// Duration creates an int argument with a duration in the given unit.
+//
+// A zero or negative unit is treated as a second.
+func Duration(d time.Duration, unit time.Duration) Arg {
+	if unit <= 0 {
+		unit = time.Second
+	}
+	return Int(int64(d / unit))
 }
 
 // Key creates a string argument to be used as a key.
@@ -80,6 +152,14 @@ func (a Arg) IsKey() bool {
 	return a.typ == typKey
 }
 
+// KeyString returns the key of a key argument
+func (a Arg) KeyString() (string, bool) {
+	if a.typ == typKey {
+		return a.str, true
+	}
+	return "", false
+}
+
 // Prefix prepends a prefix to a key argument
 func (a Arg) Prefix(prefix string) Arg {
 	if a.typ == typKey {
@@ -0,0 +1,156 @@
+package resp
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type point struct {
+	X, Y int64
+}
+
+func (p *point) AppendArg(buf []byte) []byte {
+	var scratch [64]byte
+	data := strconv.AppendInt(scratch[:0], p.X, 10)
+	data = append(data, ',')
+	data = strconv.AppendInt(data, p.Y, 10)
+	return AppendBulkString(buf, data)
+}
+
+func TestArgAppender(t *testing.T) {
+	b := new(Buffer)
+	p := &point{1, 2}
+	u, err := url.Parse("redis://localhost:6379")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin, err := Binary(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Unix(1500000000, 123000000)
+	b.Arg(
+		Appender(p),
+		Appender(nil),
+		bin,
+		Time(ts, time.Second),
+		Time(ts, time.Millisecond),
+		Duration(1500*time.Millisecond, time.Millisecond),
+		Float(0.5),
+	)
+	want := "$3\r\n1,2\r\n$-1\r\n$22\r\nredis://localhost:6379\r\n$10\r\n1500000000\r\n$13\r\n1500000000123\r\n$4\r\n1500\r\n$3\r\n0.5\r\n"
+	if got := string(b.B); got != want {
+		t.Errorf("Invalid encoding %q", got)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		b.Reset()
+		b.Arg(Appender(p))
+	})
+	if allocs != 0 {
+		t.Errorf("Appender allocates %f", allocs)
+	}
+	// Values and buffers do not encode as bulk strings
+	for _, x := range []interface{}{Value{}, new(Buffer)} {
+		if _, ok := x.(ArgAppender); ok {
+			t.Errorf("%T is an ArgAppender", x)
+		}
+	}
+}
+
+func TestReaderArg(t *testing.T) {
+	b := new(Buffer)
+	b.Array(4)
+	b.BulkString("SET")
+	b.Arg(String("foo"), Reader(strings.NewReader("hello world"), 5), Reader(nil, 0))
+	b.Arg(Reader(strings.NewReader(""), 0))
+	if n := b.Streams(); n != 2 {
+		t.Fatalf("Invalid streams %d", n)
+	}
+	if _, err := b.Buffers(nil); err != errBufferStreams {
+		t.Errorf("Invalid error %v", err)
+	}
+	w := new(bytes.Buffer)
+	n, err := b.WriteTo(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "*4\r\n$3\r\nSET\r\n$3\r\nfoo\r\n$5\r\nhello\r\n$-1\r\n$0\r\n\r\n"
+	if got := w.String(); got != want {
+		t.Errorf("Invalid encoding %q", got)
+	}
+	if n != int64(len(want)) {
+		t.Errorf("Invalid size %d", n)
+	}
+
+	b.Reset()
+	if n := b.Streams(); n != 0 {
+		t.Fatalf("Invalid streams after reset %d", n)
+	}
+	b.Arg(Reader(strings.NewReader("foo"), 5))
+	if _, err := b.WriteTo(new(bytes.Buffer)); err != io.ErrUnexpectedEOF {
+		t.Errorf("Invalid error %v", err)
+	}
+}
+
+func TestBufferRefThreshold(t *testing.T) {
+	large := bytes.Repeat([]byte("x"), 100)
+	b := new(Buffer)
+	b.Array(3)
+	b.BulkString("SET")
+	b.Arg(Raw([]byte("foo")), Raw(large))
+	want := new(Buffer)
+	want.Array(3)
+	want.BulkString("SET")
+	want.Arg(Raw([]byte("foo")), Raw(large))
+
+	b.Reset()
+	b.RefThreshold = 64
+	b.Array(3)
+	b.BulkString("SET")
+	b.Arg(Raw([]byte("foo")), Raw(large))
+	if n := b.Segments(); n != 1 {
+		t.Fatalf("Invalid segments %d", n)
+	}
+	if size := b.Size(); size != int64(len(want.B)) {
+		t.Errorf("Invalid size %d", size)
+	}
+	if len(b.B) >= len(want.B)-len(large)+1 {
+		t.Errorf("Payload copied to the buffer %d", len(b.B))
+	}
+	bufs, err := b.Buffers(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bufs) != 3 || &bufs[1][0] != &large[0] {
+		t.Errorf("Payload not referenced")
+	}
+	w := new(bytes.Buffer)
+	bufs.WriteTo(w)
+	if w.String() != string(want.B) {
+		t.Errorf("Invalid vectored write %q", w.String())
+	}
+	if got := b.AppendRESP(nil); string(got) != string(want.B) {
+		t.Errorf("Invalid append %q", got)
+	}
+	w.Reset()
+	b.WriteTo(w)
+	if w.String() != string(want.B) {
+		t.Errorf("Invalid write %q", w.String())
+	}
+
+	// Copy the command after a leading one
+	dst := new(Buffer)
+	dst.BulkString("PING")
+	dst.AppendBuffer(b, 0, len(b.B))
+	if n := dst.Segments(); n != 1 {
+		t.Fatalf("Invalid segments %d", n)
+	}
+	if got := dst.AppendRESP(nil); string(got) != "$4\r\nPING\r\n"+string(want.B) {
+		t.Errorf("Invalid copy %q", got)
+	}
+}
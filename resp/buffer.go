@@ -1,19 +1,158 @@
 package resp
 
 import (
+	"errors"
+	"io"
 	"math"
+	"net"
 	"strconv"
 )
 
 // Buffer is a utility buffer to write RESP values
 type Buffer struct {
-	B       []byte
-	scratch []byte
+	B []byte
+	// RefThreshold is the size above which raw arguments are referenced instead of copied to B.
+	// Referenced arguments must not be modified until the buffer is written.
+	// If it is zero or less all raw arguments are copied.
+	RefThreshold int
+
+	scratch  []byte
+	segments []bufferSegment
+	streams  int
+}
+
+// bufferSegment is the payload of an argument that is not copied to B.
+// It is written at an offset of B either from a referenced slice or from a reader.
+type bufferSegment struct {
+	off  int
+	buf  []byte
+	r    io.Reader
+	size int64
 }
 
 // Reset resets the buffer
 func (b *Buffer) Reset() {
 	b.B = b.B[:0]
+	for i := range b.segments {
+		b.segments[i] = bufferSegment{}
+	}
+	b.segments = b.segments[:0]
+	b.streams = 0
+}
+
+// Streams returns the number of arguments streamed from a reader.
+//
+// If it is not zero B does not hold the payload of these arguments and
+// the buffer can only be written once with WriteTo.
+func (b *Buffer) Streams() int {
+	return b.streams
+}
+
+// Segments returns the number of arguments whose payload is not copied to B.
+//
+// These are streamed arguments and raw arguments larger than RefThreshold.
+func (b *Buffer) Segments() int {
+	return len(b.segments)
+}
+
+// Size returns the total size of the buffer including arguments not copied to B
+func (b *Buffer) Size() int64 {
+	size := int64(len(b.B))
+	for i := range b.segments {
+		size += b.segments[i].size
+	}
+	return size
+}
+
+// WriteTo writes the buffer to w along with the payload of referenced and streamed arguments
+func (b *Buffer) WriteTo(w io.Writer) (n int64, err error) {
+	var (
+		pos int
+		nn  int
+		cp  int64
+	)
+	for i := range b.segments {
+		s := &b.segments[i]
+		nn, err = w.Write(b.B[pos:s.off])
+		n += int64(nn)
+		if err != nil {
+			return
+		}
+		pos = s.off
+		if s.r == nil {
+			nn, err = w.Write(s.buf)
+			n += int64(nn)
+			if err != nil {
+				return
+			}
+			continue
+		}
+		cp, err = io.CopyN(w, s.r, s.size)
+		n += cp
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return
+		}
+	}
+	nn, err = w.Write(b.B[pos:])
+	n += int64(nn)
+	return
+}
+
+var errBufferStreams = errors.New("resp: buffer has streamed arguments")
+
+// Buffers appends the buffer to bufs for a vectored write without copying referenced arguments.
+//
+// It fails if the buffer has any streamed arguments.
+func (b *Buffer) Buffers(bufs net.Buffers) (net.Buffers, error) {
+	if b.streams > 0 {
+		return bufs, errBufferStreams
+	}
+	pos := 0
+	for i := range b.segments {
+		s := &b.segments[i]
+		bufs = append(bufs, b.B[pos:s.off], s.buf)
+		pos = s.off
+	}
+	return append(bufs, b.B[pos:]), nil
+}
+
+// AppendRESP appends the buffer to buf copying the payload of referenced arguments.
+//
+// The buffer must not have any streamed arguments, check Streams before calling it.
+// AppendRESP panics otherwise.
+func (b *Buffer) AppendRESP(buf []byte) []byte {
+	pos := 0
+	for i := range b.segments {
+		s := &b.segments[i]
+		if s.r != nil {
+			panic("resp: AppendRESP with streamed arguments")
+		}
+		buf = append(buf, b.B[pos:s.off]...)
+		buf = append(buf, s.buf...)
+		pos = s.off
+	}
+	return append(buf, b.B[pos:]...)
+}
+
+// AppendBuffer appends the part of src.B between start and end to the buffer.
+//
+// Referenced and streamed arguments in this part are carried over without copying their payload.
+func (b *Buffer) AppendBuffer(src *Buffer, start, end int) {
+	off := len(b.B) - start
+	for i := range src.segments {
+		s := src.segments[i]
+		if start < s.off && s.off < end {
+			s.off += off
+			b.segments = append(b.segments, s)
+			if s.r != nil {
+				b.streams++
+			}
+		}
+	}
+	b.B = append(b.B, src.B[start:end]...)
 }
 
 // SimpleString writes a RESP simple string to the buffer
@@ -56,6 +195,56 @@ func (b *Buffer) NullString() {
 	b.B = appendNullBulkString(b.B)
 }
 
+// Map writes a RESP3 map header for n key value pairs to the buffer
+func (b *Buffer) Map(n int) {
+	b.B = appendAggregate(b.B, Map, n)
+}
+
+// Set writes a RESP3 set header to the buffer
+func (b *Buffer) Set(size int) {
+	b.B = appendAggregate(b.B, Set, size)
+}
+
+// Push writes a RESP3 push header to the buffer
+func (b *Buffer) Push(size int) {
+	b.B = appendAggregate(b.B, Push, size)
+}
+
+// Attribute writes a RESP3 attribute header for n key value pairs to the buffer
+func (b *Buffer) Attribute(n int) {
+	b.B = appendAggregate(b.B, Attribute, n)
+}
+
+// Null writes a RESP3 null to the buffer
+func (b *Buffer) Null() {
+	b.B = appendNull(b.B)
+}
+
+// Double writes a RESP3 double to the buffer
+func (b *Buffer) Double(f float64) {
+	b.B = appendDouble(b.B, f)
+}
+
+// Boolean writes a RESP3 boolean to the buffer
+func (b *Buffer) Boolean(v bool) {
+	b.B = appendBoolean(b.B, v)
+}
+
+// BigNumber writes a RESP3 big number to the buffer
+func (b *Buffer) BigNumber(n string) {
+	b.B = appendBigNumber(b.B, n)
+}
+
+// BlobError writes a RESP3 blob error to the buffer
+func (b *Buffer) BlobError(err string) {
+	b.B = appendBlobError(b.B, err)
+}
+
+// Verbatim writes a RESP3 verbatim string with a 3 letter format to the buffer
+func (b *Buffer) Verbatim(format, s string) {
+	b.B = appendVerbatim(b.B, format, s)
+}
+
 // BulkStringArray writes an array of RESP bulk strings to the buffer
 func (b *Buffer) BulkStringArray(values ...string) {
 	b.B = appendBulkStringArray(b.B, values...)
@@ -81,20 +270,49 @@ func (b *Buffer) write(a *Arg) {
 	case typString, typKey:
 		b.B = appendBulkString(b.B, a.str)
 	case typBuffer:
+		if 0 < b.RefThreshold && b.RefThreshold < len(a.buf) {
+			b.B = append(b.B, BulkString)
+			b.B = strconv.AppendInt(b.B, int64(len(a.buf)), 10)
+			b.B = appendCRLF(b.B)
+			b.segments = append(b.segments, bufferSegment{
+				off:  len(b.B),
+				buf:  a.buf,
+				size: int64(len(a.buf)),
+			})
+			b.B = appendCRLF(b.B)
+			return
+		}
 		b.B = appendBulkStringRaw(b.B, a.buf)
 	case typInt:
 		b.scratch = strconv.AppendInt(b.scratch[:0], int64(a.num), 10)
 		b.B = appendBulkStringRaw(b.B, b.scratch)
 	case typFloat:
-		b.scratch = strconv.AppendFloat(b.scratch, math.Float64frombits(a.num), 'f', -1, 64)
+		b.scratch = strconv.AppendFloat(b.scratch[:0], math.Float64frombits(a.num), 'f', -1, 64)
 		b.B = appendBulkStringRaw(b.B, b.scratch)
 	case typUint:
-		b.scratch = strconv.AppendUint(b.scratch, a.num, 10)
+		b.scratch = strconv.AppendUint(b.scratch[:0], a.num, 10)
 		b.B = appendBulkStringRaw(b.B, b.scratch)
 	case typTrue:
 		b.B = appendBulkString(b.B, "true")
 	case typFalse:
 		b.B = appendBulkString(b.B, "false")
+	case typAppender:
+		if a.app != nil {
+			b.B = a.app.AppendArg(b.B)
+		} else {
+			b.B = appendNullBulkString(b.B)
+		}
+	case typReader:
+		b.B = append(b.B, BulkString)
+		b.B = strconv.AppendUint(b.B, a.num, 10)
+		b.B = appendCRLF(b.B)
+		b.segments = append(b.segments, bufferSegment{
+			off:  len(b.B),
+			r:    a.rd,
+			size: int64(a.num),
+		})
+		b.streams++
+		b.B = appendCRLF(b.B)
 	default:
 		b.B = appendNullBulkString(b.B)
 	}
@@ -0,0 +1,424 @@
+package resp
+
+import (
+	"encoding"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DecodeError is an error decoding a value.
+//
+// Path is the location of the value inside the reply like [2].name[0]
+type DecodeError struct {
+	Path string
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Path == "" {
+		return "resp: decode error: " + e.Err.Error()
+	}
+	return "resp: decode error at " + e.Path + ": " + e.Err.Error()
+}
+
+// Decode decodes a value into dst, which must be a non nil pointer.
+//
+// Strings, numbers, bools, []byte and encoding.TextUnmarshaler values are decoded from scalar replies.
+// Slices and arrays are decoded from aggregate replies.
+// Maps and structs are decoded from RESP3 maps or arrays of alternating keys and values.
+// Struct fields are matched to map keys as described in StructFields.
+// Null values reset dst to its zero value and error replies fail with a *DecodeError.
+// Decoding into an empty interface produces string, int64, float64, bool, []interface{},
+// map[string]interface{} or nil values.
+func (v Value) Decode(dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &DecodeError{Err: typeError("cannot decode into non pointer", reflect.TypeOf(dst))}
+	}
+	return decodeValue(v, rv.Elem(), nil)
+}
+
+// decodePath is a linked list of path elements built only when reporting errors
+type decodePath struct {
+	parent *decodePath
+	index  int
+	key    string
+}
+
+func (p *decodePath) String() string {
+	if p == nil {
+		return ""
+	}
+	s := p.parent.String()
+	if p.key != "" {
+		if s == "" {
+			return p.key
+		}
+		return s + "." + p.key
+	}
+	return s + "[" + strconv.Itoa(p.index) + "]"
+}
+
+type decodeErr string
+
+func (e decodeErr) Error() string {
+	return string(e)
+}
+
+func typeError(msg string, typ reflect.Type) error {
+	if typ == nil {
+		return decodeErr(msg + " <nil>")
+	}
+	return decodeErr(msg + " " + typ.String())
+}
+
+func decodeFail(path *decodePath, err error) error {
+	return &DecodeError{Path: path.String(), Err: err}
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+func decodeValue(v Value, dst reflect.Value, path *decodePath) error {
+	if err := v.Err(); err != nil {
+		return decodeFail(path, err)
+	}
+	if v.IsNull() {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if dst.Kind() == reflect.Ptr {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return decodeValue(v, dst.Elem(), path)
+	}
+	typ := v.Type()
+	if dst.CanAddr() && dst.Addr().Type().Implements(textUnmarshalerType) && !isAggregate(typ) {
+		u := dst.Addr().Interface().(encoding.TextUnmarshaler)
+		if err := u.UnmarshalText(v.Bytes()); err != nil {
+			return decodeFail(path, err)
+		}
+		return nil
+	}
+	switch dst.Kind() {
+	case reflect.Interface:
+		if dst.NumMethod() != 0 {
+			break
+		}
+		x, err := v.decodeInterface(path)
+		if err != nil {
+			return err
+		}
+		if x == nil {
+			dst.Set(reflect.Zero(dst.Type()))
+		} else {
+			dst.Set(reflect.ValueOf(x))
+		}
+		return nil
+	case reflect.String:
+		switch typ {
+		case Integer:
+			n, _ := v.Int()
+			dst.SetString(strconv.FormatInt(n, 10))
+			return nil
+		case Boolean:
+			b, _ := v.Bool()
+			dst.SetString(strconv.FormatBool(b))
+			return nil
+		case SimpleString, BulkString, Verbatim, Double, BigNumber:
+			dst.SetString(string(v.Bytes()))
+			return nil
+		}
+	case reflect.Bool:
+		switch typ {
+		case Boolean, Integer:
+			b, _ := v.Bool()
+			dst.SetBool(b)
+			return nil
+		case SimpleString, BulkString:
+			b, err := strconv.ParseBool(string(v.Bytes()))
+			if err != nil {
+				return decodeFail(path, err)
+			}
+			dst.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := v.Int(); ok {
+			if dst.OverflowInt(n) {
+				return decodeFail(path, typeError("integer "+strconv.FormatInt(n, 10)+" overflows", dst.Type()))
+			}
+			dst.SetInt(n)
+			return nil
+		}
+		if typ == Boolean {
+			b, _ := v.Bool()
+			if b {
+				dst.SetInt(1)
+			} else {
+				dst.SetInt(0)
+			}
+			return nil
+		}
+		if !isAggregate(typ) {
+			return decodeFail(path, decodeErr("invalid integer "+strconv.Quote(string(v.Bytes()))))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n, ok := v.Int(); ok && n >= 0 {
+			if dst.OverflowUint(uint64(n)) {
+				return decodeFail(path, typeError("integer "+strconv.FormatInt(n, 10)+" overflows", dst.Type()))
+			}
+			dst.SetUint(uint64(n))
+			return nil
+		}
+		if !isAggregate(typ) {
+			n, err := strconv.ParseUint(string(v.Bytes()), 10, dst.Type().Bits())
+			if err != nil {
+				return decodeFail(path, err)
+			}
+			dst.SetUint(n)
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, ok := v.Float(); ok {
+			dst.SetFloat(f)
+			return nil
+		}
+		if !isAggregate(typ) {
+			return decodeFail(path, decodeErr("invalid float "+strconv.Quote(string(v.Bytes()))))
+		}
+	case reflect.Slice:
+		if dst.Type().Elem().Kind() == reflect.Uint8 && !isAggregate(typ) {
+			dst.SetBytes(append([]byte(nil), v.Bytes()...))
+			return nil
+		}
+		if isAggregate(typ) {
+			// Maps are decoded as a flat list of keys and values
+			n := v.Len()
+			s := reflect.MakeSlice(dst.Type(), n, n)
+			for i := 0; i < n; i++ {
+				if err := decodeValue(v.Get(i), s.Index(i), &decodePath{parent: path, index: i}); err != nil {
+					return err
+				}
+			}
+			dst.Set(s)
+			return nil
+		}
+	case reflect.Array:
+		if isAggregate(typ) {
+			n := v.Len()
+			if n != dst.Len() {
+				return decodeFail(path, typeError("cannot decode "+strconv.Itoa(n)+" elements into", dst.Type()))
+			}
+			for i := 0; i < n; i++ {
+				if err := decodeValue(v.Get(i), dst.Index(i), &decodePath{parent: path, index: i}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case reflect.Map:
+		if isAggregate(typ) {
+			return v.decodeMap(dst, path)
+		}
+	case reflect.Struct:
+		if isAggregate(typ) {
+			return v.decodeStruct(dst, path)
+		}
+	}
+	return decodeFail(path, typeError("cannot decode "+typeName(typ)+" into", dst.Type()))
+}
+
+func (v Value) decodeMap(dst reflect.Value, path *decodePath) error {
+	typ := dst.Type()
+	if dst.IsNil() {
+		dst.Set(reflect.MakeMapWithSize(typ, v.MapLen()))
+	}
+	n := v.MapLen()
+	for i := 0; i < n; i++ {
+		k, el := v.Get(2*i), v.Get(2*i+1)
+		key := reflect.New(typ.Key()).Elem()
+		if err := decodeValue(k, key, &decodePath{parent: path, index: 2 * i}); err != nil {
+			return err
+		}
+		val := reflect.New(typ.Elem()).Elem()
+		if err := decodeValue(el, val, &decodePath{parent: path, key: string(k.Bytes()), index: 2*i + 1}); err != nil {
+			return err
+		}
+		dst.SetMapIndex(key, val)
+	}
+	return nil
+}
+
+func (v Value) decodeStruct(dst reflect.Value, path *decodePath) error {
+	fields := StructFieldsOf(dst.Type())
+	n := v.MapLen()
+	for i := 0; i < n; i++ {
+		k := v.Get(2 * i)
+		name := k.Bytes()
+		if name == nil {
+			continue
+		}
+		j := fields.Lookup(name)
+		if j == -1 {
+			continue
+		}
+		if err := decodeValue(v.Get(2*i+1), dst.Field(fields.Fields[j].Index), &decodePath{parent: path, key: string(name)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v Value) decodeInterface(path *decodePath) (interface{}, error) {
+	switch typ := v.Type(); typ {
+	case SimpleString, BulkString, Verbatim, BigNumber:
+		return string(v.Bytes()), nil
+	case Integer:
+		n, _ := v.Int()
+		return n, nil
+	case Double:
+		f, _ := v.Float()
+		return f, nil
+	case Boolean:
+		b, _ := v.Bool()
+		return b, nil
+	case Map:
+		m := make(map[string]interface{}, v.MapLen())
+		for i := 0; i < v.MapLen(); i++ {
+			k := v.Get(2 * i)
+			var key string
+			if err := decodeValue(k, reflect.ValueOf(&key).Elem(), &decodePath{parent: path, index: 2 * i}); err != nil {
+				return nil, err
+			}
+			x, err := v.Get(2*i + 1).decodeValueInterface(&decodePath{parent: path, key: key, index: 2*i + 1})
+			if err != nil {
+				return nil, err
+			}
+			m[key] = x
+		}
+		return m, nil
+	case Array, Set, Push:
+		s := make([]interface{}, v.Len())
+		for i := range s {
+			x, err := v.Get(i).decodeValueInterface(&decodePath{parent: path, index: i})
+			if err != nil {
+				return nil, err
+			}
+			s[i] = x
+		}
+		return s, nil
+	default:
+		return nil, decodeFail(path, decodeErr("cannot decode "+typeName(typ)))
+	}
+}
+
+// decodeValueInterface decodes an element into an interface checking for errors and nulls
+func (v Value) decodeValueInterface(path *decodePath) (interface{}, error) {
+	if err := v.Err(); err != nil {
+		return nil, decodeFail(path, err)
+	}
+	if v.IsNull() {
+		return nil, nil
+	}
+	return v.decodeInterface(path)
+}
+
+func typeName(typ byte) string {
+	switch typ {
+	case SimpleString:
+		return "simple string"
+	case BulkString:
+		return "bulk string"
+	case Integer:
+		return "integer"
+	case Array:
+		return "array"
+	case Double:
+		return "double"
+	case Boolean:
+		return "boolean"
+	case Verbatim:
+		return "verbatim string"
+	case BigNumber:
+		return "big number"
+	case Map:
+		return "map"
+	case Set:
+		return "set"
+	case Push:
+		return "push"
+	default:
+		return "value"
+	}
+}
+
+// StructFields maps the fields of a struct type to the keys of a map reply.
+//
+// Exported fields are mapped to the name in their `redis:"name"` tag or to their field name if the tag has no name.
+// Fields tagged with `redis:"-"` are ignored.
+// Options follow the name separated by commas; `omitempty` skips zero values when encoding.
+// Keys are matched by exact name falling back to a case insensitive match.
+type StructFields struct {
+	Fields []StructField
+}
+
+// StructField is a struct field mapped to a key
+type StructField struct {
+	Name      string
+	Index     int // index of the field in the struct
+	OmitEmpty bool
+}
+
+// Lookup finds the position in Fields of the field matching name or returns -1
+func (f *StructFields) Lookup(name []byte) int {
+	for i := range f.Fields {
+		if f.Fields[i].Name == string(name) {
+			return i
+		}
+	}
+	for i := range f.Fields {
+		if strings.EqualFold(f.Fields[i].Name, string(name)) {
+			return i
+		}
+	}
+	return -1
+}
+
+var structFieldsCache sync.Map // map[reflect.Type]*StructFields
+
+// StructFieldsOf returns the fields of a struct type
+func StructFieldsOf(typ reflect.Type) *StructFields {
+	if f, ok := structFieldsCache.Load(typ); ok {
+		return f.(*StructFields)
+	}
+	fields := new(StructFields)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := field.Tag.Get("redis")
+		if tag == "-" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		f := StructField{
+			Name:  opts[0],
+			Index: i,
+		}
+		if f.Name == "" {
+			f.Name = field.Name
+		}
+		for _, opt := range opts[1:] {
+			if opt == "omitempty" {
+				f.OmitEmpty = true
+			}
+		}
+		fields.Fields = append(fields.Fields, f)
+	}
+	f, _ := structFieldsCache.LoadOrStore(typ, fields)
+	return f.(*StructFields)
+}
@@ -0,0 +1,92 @@
+package resp
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestValueDecode(t *testing.T) {
+	b := new(Buffer)
+	b.Map(3)
+	b.BulkString("name")
+	b.BulkString("foo")
+	b.BulkString("scores")
+	b.Array(2)
+	b.Double(1.5)
+	b.Int(2)
+	b.BulkString("tags")
+	b.Map(1)
+	b.BulkString("ip")
+	b.BulkString("10.0.0.1")
+	v, err := ParseValue(b.B)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type item struct {
+		Name   string
+		Scores []float64         `redis:"scores"`
+		Tags   map[string]net.IP `redis:"tags"`
+	}
+	var x item
+	if err := v.Decode(&x); err != nil {
+		t.Fatal(err)
+	}
+	if x.Name != "foo" || !reflect.DeepEqual(x.Scores, []float64{1.5, 2}) || !x.Tags["ip"].Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("Invalid decode %+v", x)
+	}
+
+	var any interface{}
+	if err := v.Decode(&any); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"name":   "foo",
+		"scores": []interface{}{1.5, int64(2)},
+		"tags":   map[string]interface{}{"ip": "10.0.0.1"},
+	}
+	if !reflect.DeepEqual(any, want) {
+		t.Errorf("Invalid decode %#v", any)
+	}
+}
+
+func TestValueDecodeError(t *testing.T) {
+	b := new(Buffer)
+	b.Array(2)
+	b.Null()
+	b.Map(1)
+	b.BulkString("answer")
+	b.Array(2)
+	b.Int(42)
+	b.BulkString("NaN?")
+	v, err := ParseValue(b.B)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var x []map[string][]int
+	err = Value{}.Decode(x)
+	if err == nil {
+		t.Errorf("Expected an error for non pointer")
+	}
+	var n int
+	if err := v.Get(1).Get(1).Get(0).Decode(&n); err != nil || n != 42 {
+		t.Errorf("Invalid decode %d %v", n, err)
+	}
+	err = v.Decode(&x)
+	e, ok := err.(*DecodeError)
+	if !ok {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if e.Path != "[1].answer[1]" {
+		t.Errorf("Invalid error path %q", e.Path)
+	}
+
+	b.Reset()
+	b.Array(1)
+	b.Error("ERR failed")
+	v, _ = ParseValue(b.B)
+	var s []string
+	if err, ok := v.Decode(&s).(*DecodeError); !ok || err.Path != "[0]" || err.Err.Error() != "ERR failed" {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"bytes"
 	"errors"
+	"math"
+	"strconv"
 )
 
 // Reply is a reply for a redis command.
@@ -32,6 +34,7 @@ type value struct {
 	end   int
 	num   int64
 	typ   byte
+	attr  int // id+1 of the attributes of the value
 	arr   []int
 }
 
@@ -41,6 +44,34 @@ func (reply *Reply) Reset() {
 	reply.buffer = reply.buffer[:0]
 }
 
+// Mark is a position in a reply
+type Mark struct {
+	n    int
+	size int
+}
+
+// Mark returns the current position of the reply
+func (reply *Reply) Mark() Mark {
+	return Mark{n: reply.n, size: len(reply.buffer)}
+}
+
+// Rewind discards all values read after a mark invalidating any Value pointing to them.
+func (reply *Reply) Rewind(m Mark) {
+	if 0 <= m.n && m.n <= reply.n && 0 <= m.size && m.size <= len(reply.buffer) {
+		reply.n = m.n
+		reply.values = reply.values[:m.n]
+		reply.buffer = reply.buffer[:m.size]
+	}
+}
+
+// Since returns the first value read after a mark or a Null value
+func (reply *Reply) Since(m Mark) Value {
+	if 0 <= m.n && m.n < reply.n {
+		return Value{id: m.n, reply: reply}
+	}
+	return Null()
+}
+
 // Null returns a Null value
 func Null() Value {
 	return Value{-1, nil}
@@ -82,25 +113,40 @@ func (v Value) get() *value {
 	return nil
 }
 
-// Get returns the i-th element of an array reply.
+// Get returns the i-th element of an aggregate reply.
+//
+// Map elements are indexed as a flat list of alternating keys and values.
 func (v Value) Get(i int) Value {
-	if vv := v.get(); vv != nil && vv.typ == Array && 0 <= i && i < len(vv.arr) {
+	if vv := v.get(); vv != nil && isAggregate(vv.typ) && 0 <= i && i < len(vv.arr) {
 		return Value{id: vv.arr[i], reply: v.reply}
 	}
 	return Null()
 }
 
 // Bytes returns the slice of bytes for a value.
+//
+// For verbatim strings the format prefix is not included.
 func (v Value) Bytes() []byte {
-	if vv := v.get(); vv != nil && (vv.typ == SimpleString || vv.typ == BulkString) {
-		return vv.slice(v.reply.buffer)
+	if vv := v.get(); vv != nil {
+		switch vv.typ {
+		case SimpleString, BulkString, Verbatim, Double, BigNumber:
+			return vv.slice(v.reply.buffer)
+		}
 	}
 	return nil
 }
 
+// Format returns the 3 letter format of a verbatim string value.
+func (v Value) Format() string {
+	if vv := v.get(); vv != nil && vv.typ == Verbatim && vv.start >= 4 {
+		return string(v.reply.buffer[vv.start-4 : vv.start-1])
+	}
+	return ""
+}
+
 // Err returns an error if the value is an error value.
 func (v Value) Err() error {
-	if vv := v.get(); vv != nil && vv.typ == Error {
+	if vv := v.get(); vv != nil && (vv.typ == Error || vv.typ == BlobError) {
 		return errors.New(string(vv.slice(v.reply.buffer)))
 	}
 	return nil
@@ -127,29 +173,112 @@ func (v Value) Int() (int64, bool) {
 		switch vv.typ {
 		case Integer:
 			return vv.num, true
-		case SimpleString, BulkString:
+		case SimpleString, BulkString, BigNumber:
 			return btoi(vv.slice(v.reply.buffer))
 		}
 	}
 	return 0, false
 }
 
+// Float returns the reply as float.
+func (v Value) Float() (float64, bool) {
+	if vv := v.get(); vv != nil {
+		switch vv.typ {
+		case Integer:
+			return float64(vv.num), true
+		case Double, SimpleString, BulkString, BigNumber:
+			return btof(vv.slice(v.reply.buffer))
+		}
+	}
+	return 0, false
+}
+
+// Bool returns the reply as bool.
+//
+// Integer replies are true if they are non-zero.
+func (v Value) Bool() (bool, bool) {
+	if vv := v.get(); vv != nil {
+		switch vv.typ {
+		case Boolean, Integer:
+			return vv.num != 0, true
+		}
+	}
+	return false, false
+}
+
 // IsNull checks if a value is the NullValue.
 func (v Value) IsNull() bool {
 	if vv := v.get(); vv != nil {
-		return vv.num == -1 && (vv.typ == BulkString || vv.typ == Array)
+		switch vv.typ {
+		case Nil:
+			return true
+		case BulkString, Array:
+			return vv.num == -1
+		default:
+			return false
+		}
 	}
 	return v.id == -1
 }
 
-// Len returns the number of an array value's elements.
+// Len returns the number of an aggregate value's elements.
+//
+// For maps this is twice the number of key value pairs.
 func (v Value) Len() int {
 	if vv := v.get(); vv != nil {
+		if vv.start == streamedAggregate {
+			return vv.size()
+		}
 		return len(vv.arr)
 	}
 	return 0
 }
 
+// MapLen returns the number of key value pairs in a map or a key value array.
+func (v Value) MapLen() int {
+	if vv := v.get(); vv != nil && isAggregate(vv.typ) {
+		if vv.start == streamedAggregate {
+			return vv.size() / 2
+		}
+		return len(vv.arr) / 2
+	}
+	return 0
+}
+
+// size returns the number of elements of a streamed aggregate value
+func (v *value) size() int {
+	switch {
+	case v.num <= 0:
+		return 0
+	case v.typ == Map || v.typ == Attribute:
+		return 2 * int(v.num)
+	default:
+		return int(v.num)
+	}
+}
+
+// Attributes returns the RESP3 attributes attached to a value or a NullValue.
+func (v Value) Attributes() Value {
+	if vv := v.get(); vv != nil && vv.attr > 0 {
+		return Value{id: vv.attr - 1, reply: v.reply}
+	}
+	return Null()
+}
+
+func btof(buf []byte) (float64, bool) {
+	switch string(buf) {
+	case "inf", "+inf":
+		return math.Inf(1), true
+	case "-inf":
+		return math.Inf(-1), true
+	}
+	f, err := strconv.ParseFloat(string(buf), 64)
+	if err != nil {
+		return 0, false
+	}
+	return f, true
+}
+
 func btoi(buf []byte) (int64, bool) {
 	var (
 		signed bool
@@ -175,104 +304,173 @@ func btoi(buf []byte) (int64, bool) {
 
 // ReadFromN reads n replies from a redis stream.
 func (reply *Reply) ReadFromN(r *bufio.Reader, n int64) (Value, error) {
-	id := reply.n
 	reply.values = reply.values[:cap(reply.values)]
-	err := reply.readArray(r, n)
+	id, err := reply.readArray(r, n)
 	reply.values = reply.values[:reply.n]
 	return Value{id: id, reply: reply}, err
 }
 
-func (reply *Reply) readArray(r *bufio.Reader, n int64) error {
+func (reply *Reply) readArray(r *bufio.Reader, n int64) (int, error) {
 	if n < -1 {
-		return ProtocolError(`Invalid array size`)
+		return -1, ProtocolError(`Invalid array size`)
 	}
+	return reply.readAggregate(r, Array, n, n)
+}
+
+// readAggregate reads size values as the elements of an aggregate value.
+func (reply *Reply) readAggregate(r *bufio.Reader, typ byte, n, size int64) (int, error) {
 	id := reply.n
 	v := reply.value()
-	v.typ = Array
+	v.typ = typ
 	v.num = n
 	v.start = -1
 	v.end = -1
+	v.attr = 0
 	v.arr = v.arr[:0]
 	if n == -1 {
-		return nil
+		return id, nil
 	}
-	for i := int64(0); i < n; i++ {
-		v.arr = append(v.arr, reply.n)
-		if err := reply.read(r); err != nil {
-			return err
+	for i := int64(0); i < size; i++ {
+		el, err := reply.read(r)
+		if err != nil {
+			return id, err
 		}
+		v.arr = append(v.arr, el)
 	}
 	reply.values[id] = *v
-	return nil
+	return id, nil
 }
 
 // ReadFrom reads a single reply from a redis stream.
 func (reply *Reply) ReadFrom(r *bufio.Reader) (Value, error) {
-	id := reply.n
 	reply.values = reply.values[:cap(reply.values)]
-	err := reply.read(r)
+	id, err := reply.read(r)
 	reply.values = reply.values[:reply.n]
 	return Value{id: id, reply: reply}, err
 }
 
-func (reply *Reply) read(r *bufio.Reader) error {
+// read reads a value and returns its id.
+func (reply *Reply) read(r *bufio.Reader) (int, error) {
 	typ, err := r.ReadByte()
 	if err != nil {
-		return err
+		return -1, err
 	}
 	switch typ {
-	case Error, SimpleString:
+	case Error, SimpleString, Double, BigNumber:
 		start := len(reply.buffer)
 		reply.buffer, err = readLine(reply.buffer, r)
 		if err != nil {
-			return err
+			return -1, err
 		}
+		id := reply.n
 		v := reply.value()
 		v.typ = typ
 		v.num = 0
+		v.attr = 0
 		v.arr = v.arr[:0]
 		v.start = start
 		v.end = len(reply.buffer)
-		return nil
+		return id, nil
+	case Nil, Boolean:
+		var line []byte
+		line, _, err = r.ReadLine()
+		if err != nil {
+			return -1, err
+		}
+		var n int64 = -1
+		if typ == Boolean {
+			switch string(line) {
+			case "t":
+				n = 1
+			case "f":
+				n = 0
+			default:
+				return -1, ProtocolError(`Invalid boolean value`)
+			}
+		}
+		id := reply.n
+		v := reply.value()
+		v.typ = typ
+		v.num = n
+		v.attr = 0
+		v.arr = v.arr[:0]
+		v.start = -1
+		v.end = -1
+		return id, nil
 	case Integer:
 		var n int64
 		n, err = readInt(r)
 		if err != nil {
-			return err
+			return -1, err
 		}
+		id := reply.n
 		v := reply.value()
 		v.typ = typ
+		v.attr = 0
 		v.arr = v.arr[:0]
 		v.start = -1
 		v.num = n
-		return nil
-	case BulkString:
+		return id, nil
+	case BulkString, BlobError, Verbatim:
 		var n int64
 		n, err = readInt(r)
 		if err != nil {
-			return err
+			return -1, err
 		}
 		start := len(reply.buffer)
 		reply.buffer, err = ReadBulkString(reply.buffer, n, r)
 		if err != nil {
-			return err
+			return -1, err
+		}
+		if typ == Verbatim {
+			// Skip the 3 letter format and the ':' separator
+			if n < 4 {
+				return -1, ProtocolError(`Invalid verbatim string`)
+			}
+			start += 4
 		}
+		id := reply.n
 		v := reply.value()
 		v.start = start
 		v.num = n
 		v.typ = typ
+		v.attr = 0
 		v.arr = v.arr[:0]
 		v.end = len(reply.buffer)
-		return nil
-	case Array:
+		return id, nil
+	case Array, Set, Push:
 		var n int64
 		n, err = readInt(r)
 		if err != nil {
-			return err
+			return -1, err
+		}
+		if n < -1 {
+			return -1, ProtocolError(`Invalid array size`)
 		}
-		return reply.readArray(r, n)
+		return reply.readAggregate(r, typ, n, n)
+	case Map, Attribute:
+		var n int64
+		n, err = readInt(r)
+		if err != nil {
+			return -1, err
+		}
+		if n < 0 {
+			return -1, ProtocolError(`Invalid map size`)
+		}
+		id, err := reply.readAggregate(r, typ, n, 2*n)
+		if err != nil || typ == Map {
+			return id, err
+		}
+		// Attributes are attached to the value that follows them
+		attr := id
+		id, err = reply.read(r)
+		if err != nil {
+			return id, err
+		}
+		reply.values[id].attr = attr + 1
+		return id, nil
 	default:
-		return ProtocolError(`Invalid RESP value type`)
+		return -1, ProtocolError(`Invalid RESP value type`)
 	}
 }
 
@@ -283,24 +481,24 @@ func (reply *Reply) get(id int) *value {
 	return nil
 }
 
-// ForEach iterates each value in a BulkStringArray reply
+// ForEach iterates each value in an aggregate reply
 func (v Value) ForEach(fn func(v Value)) {
 	if fn == nil {
 		return
 	}
-	if vv := v.reply.get(v.id); vv != nil || vv.typ == Array {
+	if vv := v.reply.get(v.id); vv != nil && isAggregate(vv.typ) {
 		for _, id := range vv.arr {
 			fn(Value{id: id, reply: v.reply})
 		}
 	}
 }
 
-// ForEachKV iterates each key value pair in a BulkStringArray reply
+// ForEachKV iterates each key value pair in a map or a BulkStringArray reply
 func (v Value) ForEachKV(fn func(k []byte, v Value)) {
 	if fn == nil {
 		return
 	}
-	if vv := v.reply.get(v.id); vv != nil && vv.typ == Array {
+	if vv := v.reply.get(v.id); vv != nil && isAggregate(vv.typ) {
 		var k *value
 		for i, id := range vv.arr {
 			if i%2 == 0 {
@@ -316,3 +514,58 @@ func (v Value) ForEachKV(fn func(k []byte, v Value)) {
 	}
 
 }
+
+// AppendRESP appends the RESP encoding of a value to a buffer
+func (v Value) AppendRESP(buf []byte) []byte {
+	vv := v.get()
+	if vv == nil {
+		return appendNullBulkString(buf)
+	}
+	if vv.attr > 0 {
+		buf = Value{id: vv.attr - 1, reply: v.reply}.AppendRESP(buf)
+	}
+	switch vv.typ {
+	case SimpleString, Error, Double, BigNumber:
+		buf = append(buf, vv.typ)
+		buf = append(buf, vv.slice(v.reply.buffer)...)
+		return appendCRLF(buf)
+	case Integer:
+		return appendInt(buf, vv.num)
+	case Nil:
+		return appendNull(buf)
+	case Boolean:
+		return appendBoolean(buf, vv.num != 0)
+	case BulkString, BlobError:
+		if vv.num == -1 {
+			return appendNullBulkString(buf)
+		}
+		data := vv.slice(v.reply.buffer)
+		buf = append(buf, vv.typ)
+		buf = strconv.AppendInt(buf, int64(len(data)), 10)
+		buf = appendCRLF(buf)
+		buf = append(buf, data...)
+		return appendCRLF(buf)
+	case Verbatim:
+		return appendVerbatim(buf, v.Format(), string(vv.slice(v.reply.buffer)))
+	case Array, Set, Push, Map, Attribute:
+		if vv.num == -1 {
+			return appendNullArray(buf)
+		}
+		buf = appendAggregate(buf, vv.typ, int(vv.num))
+		for _, id := range vv.arr {
+			buf = Value{id: id, reply: v.reply}.AppendRESP(buf)
+		}
+		return buf
+	default:
+		return appendNullBulkString(buf)
+	}
+}
+
+func isAggregate(typ byte) bool {
+	switch typ {
+	case Array, Map, Set, Push, Attribute:
+		return true
+	default:
+		return false
+	}
+}
@@ -108,3 +108,162 @@ func TestParseValue(t *testing.T) {
 		}
 	}
 }
+
+func TestReplyRESP3(t *testing.T) {
+	b := new(Buffer)
+	b.Attribute(1)
+	b.SimpleString("ttl")
+	b.Int(3600)
+	b.Map(3)
+	b.SimpleString("pi")
+	b.Double(3.14)
+	b.SimpleString("ok")
+	b.Boolean(true)
+	b.SimpleString("tags")
+	b.Set(2)
+	b.BulkString("foo")
+	b.BulkString("bar")
+	b.Push(2)
+	b.BulkString("invalidate")
+	b.Null()
+	b.Verbatim("txt", "hello")
+	b.BigNumber("3492890328409238509324850943850943825024385")
+	b.BlobError("SYNTAX invalid syntax")
+	r := bufio.NewReader(bytes.NewReader(b.B))
+	v, err := new(Reply).ReadFromN(r, 5)
+	if err != nil {
+		t.Fatalf("Read failed %s", err)
+	}
+	if v.Len() != 5 {
+		t.Fatalf("Invalid size %d", v.Len())
+	}
+	m := v.Get(0)
+	if m.Type() != Map || m.MapLen() != 3 {
+		t.Fatalf("Invalid map %v", m)
+	}
+	if ttl, _ := m.Attributes().Get(1).Int(); ttl != 3600 {
+		t.Errorf("Invalid attributes %d", ttl)
+	}
+	m.ForEachKV(func(k []byte, v Value) {
+		switch string(k) {
+		case "pi":
+			if f, ok := v.Float(); !ok || f != 3.14 {
+				t.Errorf("Invalid double %f", f)
+			}
+		case "ok":
+			if b, ok := v.Bool(); !ok || !b {
+				t.Errorf("Invalid boolean %v", v)
+			}
+		case "tags":
+			if v.Type() != Set || v.Len() != 2 || string(v.Get(1).Bytes()) != "bar" {
+				t.Errorf("Invalid set %v", v)
+			}
+		default:
+			t.Errorf("Invalid key %q", k)
+		}
+	})
+	if p := v.Get(1); p.Type() != Push || !p.Get(1).IsNull() {
+		t.Errorf("Invalid push %v", p)
+	}
+	if s := v.Get(2); s.Format() != "txt" || string(s.Bytes()) != "hello" {
+		t.Errorf("Invalid verbatim %q %q", s.Format(), s.Bytes())
+	}
+	if n := v.Get(3); n.Type() != BigNumber || len(n.Bytes()) != 43 {
+		t.Errorf("Invalid big number %s", n.Bytes())
+	}
+	if err := v.Get(4).Err(); err == nil || err.Error() != "SYNTAX invalid syntax" {
+		t.Errorf("Invalid blob error %v", err)
+	}
+	if err := DiscardN(bufio.NewReader(bytes.NewReader(b.B)), 5); err != nil {
+		t.Errorf("Discard failed %s", err)
+	}
+}
+
+func TestValueAppendRESP(t *testing.T) {
+	b := new(Buffer)
+	b.Array(3)
+	b.Map(1)
+	b.SimpleString("foo")
+	b.Attribute(1)
+	b.SimpleString("ttl")
+	b.Int(10)
+	b.Verbatim("mkd", "# bar")
+	b.NullString()
+	b.Set(2)
+	b.Double(1.5)
+	b.Boolean(false)
+	v, err := ParseValue(b.B)
+	if err != nil {
+		t.Fatalf("Parse failed %s", err)
+	}
+	if out := v.AppendRESP(nil); !bytes.Equal(out, b.B) {
+		t.Errorf("Invalid RESP %q != %q", out, b.B)
+	}
+}
+
+func TestCopyBulkString(t *testing.T) {
+	b := new(Buffer)
+	b.BulkString("foo")
+	b.NullString()
+	b.Null()
+	b.Verbatim("txt", "bar")
+	b.Error("ERR foo")
+	b.Int(42)
+	b.SimpleString("OK")
+	r := bufio.NewReader(bytes.NewReader(b.B))
+	w := new(bytes.Buffer)
+	for _, want := range []struct {
+		n   int64
+		err string
+	}{
+		{3, ""},
+		{-1, ""},
+		{-1, ""},
+		{3, ""},
+		{0, "ERR foo"},
+		{0, "Invalid bulk string type"},
+	} {
+		n, err := CopyBulkString(w, r)
+		if n != want.n {
+			t.Errorf("Invalid size %d != %d", n, want.n)
+		}
+		msg := ""
+		if err != nil {
+			msg = err.Error()
+		}
+		if msg != want.err {
+			t.Errorf("Invalid error %q != %q", msg, want.err)
+		}
+	}
+	if w.String() != "foobar" {
+		t.Errorf("Invalid output %q", w.String())
+	}
+	if line, _, _ := r.ReadLine(); string(line) != "+OK" {
+		t.Errorf("Stream out of sync %q", line)
+	}
+}
+
+func TestReadBulkStringLarge(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 10000)
+	b := new(Buffer)
+	b.BulkStringBytes(data)
+	r := bufio.NewReaderSize(bytes.NewReader(append(b.B, b.B...)), 16)
+	// Reuse a buffer that already has enough capacity
+	buf := make([]byte, 0, 2*len(data))
+	for i := 0; i < 2; i++ {
+		if c, _ := r.ReadByte(); c != BulkString {
+			t.Fatalf("Invalid type %q", c)
+		}
+		n, err := readInt(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf, err = ReadBulkString(buf[:0], n, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, data) {
+			t.Errorf("Invalid bulk string size %d", len(buf))
+		}
+	}
+}
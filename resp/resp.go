@@ -3,6 +3,9 @@ package resp
 
 import (
 	"bufio"
+	"errors"
+	"io"
+	"math"
 	"strconv"
 )
 
@@ -15,6 +18,20 @@ const (
 	Array        byte = '*'
 )
 
+// RESP3 value types
+const (
+	Nil       byte = '_'
+	Double    byte = ','
+	Boolean   byte = '#'
+	BlobError byte = '!'
+	Verbatim  byte = '='
+	BigNumber byte = '('
+	Map       byte = '%'
+	Set       byte = '~'
+	Attribute byte = '|'
+	Push      byte = '>'
+)
+
 // ProtocolError is a RESP protocol error
 type ProtocolError string
 
@@ -48,6 +65,7 @@ func ReadBulkString(buf []byte, size int64, r *bufio.Reader) ([]byte, error) {
 			copy(tmp, buf)
 			buf = tmp
 		}
+		buf = buf[:size]
 		for err == nil && n < size {
 			nn, err = r.Read(buf[n:])
 			n += int64(nn)
@@ -66,6 +84,74 @@ func ReadBulkString(buf []byte, size int64, r *bufio.Reader) ([]byte, error) {
 	}
 }
 
+// CopyBulkString copies a RESP bulk string from a reader to w without buffering it.
+//
+// It returns -1 if the value is null.
+// Error replies are returned as errors and other values are discarded with a ProtocolError.
+func CopyBulkString(w io.Writer, r *bufio.Reader) (int64, error) {
+	typ, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	switch typ {
+	case BulkString, Verbatim:
+		size, err := readInt(r)
+		if err != nil {
+			return 0, err
+		}
+		if size == -1 {
+			return -1, nil
+		}
+		if size < 0 {
+			return 0, ProtocolError(`Invalid bulk string size`)
+		}
+		if typ == Verbatim {
+			// Skip the 3 letter format and the ':' separator
+			if size < 4 {
+				return 0, ProtocolError(`Invalid verbatim string`)
+			}
+			if _, err := r.Discard(4); err != nil {
+				return 0, err
+			}
+			size -= 4
+		}
+		n, err := io.CopyN(w, r, size)
+		if err == nil {
+			_, err = r.Discard(2)
+		} else if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return n, err
+	case Nil:
+		_, _, err := r.ReadLine()
+		return -1, err
+	case Error:
+		line, err := readLine(nil, r)
+		if err != nil {
+			return 0, err
+		}
+		return 0, errors.New(string(line))
+	case BlobError:
+		size, err := readInt(r)
+		if err != nil {
+			return 0, err
+		}
+		msg, err := ReadBulkString(nil, size, r)
+		if err != nil {
+			return 0, err
+		}
+		return 0, errors.New(string(msg))
+	default:
+		if err := r.UnreadByte(); err != nil {
+			return 0, err
+		}
+		if err := Discard(r); err != nil {
+			return 0, err
+		}
+		return 0, ProtocolError(`Invalid bulk string type`)
+	}
+}
+
 func readLine(buf []byte, r *bufio.Reader) ([]byte, error) {
 	line, isPrefix, err := r.ReadLine()
 	buf = append(buf, line...)
@@ -125,7 +211,7 @@ func Discard(r *bufio.Reader) error {
 		return err
 	}
 	switch c {
-	case SimpleString, Error, Integer:
+	case SimpleString, Error, Integer, Nil, Double, Boolean, BigNumber:
 		for {
 			_, isPrefix, err := r.ReadLine()
 			if err != nil {
@@ -135,14 +221,14 @@ func Discard(r *bufio.Reader) error {
 				return nil
 			}
 		}
-	case BulkString:
+	case BulkString, BlobError, Verbatim:
 		var n int64
 		n, err = readInt(r)
-		if err == nil {
+		if err == nil && n >= 0 {
 			_, err = r.Discard(int(n) + 2)
 		}
 		return err
-	case Array:
+	case Array, Set, Push:
 		var n int64
 		n, err = readInt(r)
 		for err == nil && n > 0 {
@@ -150,6 +236,24 @@ func Discard(r *bufio.Reader) error {
 			n--
 		}
 		return err
+	case Map:
+		var n int64
+		n, err = readInt(r)
+		if err == nil {
+			err = DiscardN(r, 2*n)
+		}
+		return err
+	case Attribute:
+		// Attributes precede the value they describe
+		var n int64
+		n, err = readInt(r)
+		if err == nil {
+			err = DiscardN(r, 2*n)
+		}
+		if err == nil {
+			err = Discard(r)
+		}
+		return err
 	default:
 		r.UnreadByte()
 		return ProtocolError(`Invalid RESP type`)
@@ -212,6 +316,65 @@ func appendBulkStringArray(buf []byte, values ...string) []byte {
 	return buf
 }
 
+func appendAggregate(buf []byte, typ byte, n int) []byte {
+	buf = append(buf, typ)
+	buf = strconv.AppendInt(buf, int64(n), 10)
+	return appendCRLF(buf)
+}
+
+func appendNull(buf []byte) []byte {
+	return append(buf, Nil, '\r', '\n')
+}
+
+func appendDouble(buf []byte, f float64) []byte {
+	buf = append(buf, Double)
+	switch {
+	case math.IsInf(f, 1):
+		buf = append(buf, "inf"...)
+	case math.IsInf(f, -1):
+		buf = append(buf, "-inf"...)
+	case math.IsNaN(f):
+		buf = append(buf, "nan"...)
+	default:
+		buf = strconv.AppendFloat(buf, f, 'f', -1, 64)
+	}
+	return appendCRLF(buf)
+}
+
+func appendBoolean(buf []byte, b bool) []byte {
+	if b {
+		return append(buf, Boolean, 't', '\r', '\n')
+	}
+	return append(buf, Boolean, 'f', '\r', '\n')
+}
+
+func appendBigNumber(buf []byte, n string) []byte {
+	buf = append(buf, BigNumber)
+	buf = append(buf, n...)
+	return appendCRLF(buf)
+}
+
+func appendBlobError(buf []byte, err string) []byte {
+	buf = append(buf, BlobError)
+	buf = strconv.AppendInt(buf, int64(len(err)), 10)
+	buf = appendCRLF(buf)
+	buf = append(buf, err...)
+	return appendCRLF(buf)
+}
+
+func appendVerbatim(buf []byte, format, s string) []byte {
+	if len(format) != 3 {
+		format = "txt"
+	}
+	buf = append(buf, Verbatim)
+	buf = strconv.AppendInt(buf, int64(len(s)+4), 10)
+	buf = appendCRLF(buf)
+	buf = append(buf, format...)
+	buf = append(buf, ':')
+	buf = append(buf, s...)
+	return appendCRLF(buf)
+}
+
 func appendIntArray(buf []byte, values ...int64) []byte {
 	buf = appendArray(buf, len(values))
 	for _, n := range values {
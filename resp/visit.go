@@ -0,0 +1,114 @@
+package resp
+
+import (
+	"bufio"
+)
+
+// VisitFunc is called for each value of a reply as it is read from a stream.
+//
+// The path holds the index of the value in each enclosing aggregate starting with
+// the index of the reply in the stream and depth is the number of enclosing aggregates.
+// Aggregate values are visited before their elements. They have no elements but
+// Len and MapLen report the number of elements that follow.
+// Attributes are visited at the path of the value they describe, before it.
+//
+// Both the value and the path are only valid during the call.
+type VisitFunc func(depth int, path []int, v Value) error
+
+// streamedAggregate marks the start of an aggregate value whose elements are streamed
+const streamedAggregate = -2
+
+// VisitN reads n replies from a redis stream calling fn for each value.
+//
+// The reply is used as a scratch buffer and is reset before each value,
+// so memory use is bounded by the size of the largest scalar value.
+// If fn returns an error the remaining values are discarded and the error is returned.
+func (reply *Reply) VisitN(r *bufio.Reader, n int64, fn VisitFunc) error {
+	v := visitor{
+		reply: reply,
+		fn:    fn,
+		path:  make([]int, 0, 8),
+	}
+	defer reply.Reset()
+	for i := int64(0); i < n; i++ {
+		if err := v.visit(r, int(i)); err != nil {
+			return err
+		}
+	}
+	return v.err
+}
+
+type visitor struct {
+	reply *Reply
+	fn    VisitFunc
+	path  []int
+	err   error // error returned by fn
+}
+
+// visit reads the i-th element of the current aggregate
+func (v *visitor) visit(r *bufio.Reader, i int) error {
+	v.path = append(v.path, i)
+	defer func() { v.path = v.path[:len(v.path)-1] }()
+	for {
+		typ, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		var n, size int64
+		switch typ {
+		case Array, Set, Push:
+			if n, err = readInt(r); err != nil {
+				return err
+			}
+			if n < -1 {
+				return ProtocolError(`Invalid array size`)
+			}
+			size = n
+		case Map, Attribute:
+			if n, err = readInt(r); err != nil {
+				return err
+			}
+			if n < 0 {
+				return ProtocolError(`Invalid map size`)
+			}
+			size = 2 * n
+		default:
+			// Scalar values are read with the regular reply parser
+			if err := r.UnreadByte(); err != nil {
+				return err
+			}
+			v.reply.Reset()
+			if _, err := v.reply.ReadFrom(r); err != nil {
+				return err
+			}
+			v.call(Value{id: 0, reply: v.reply})
+			return nil
+		}
+		v.reply.Reset()
+		v.reply.values = v.reply.values[:cap(v.reply.values)]
+		h := v.reply.value()
+		h.typ = typ
+		h.num = n
+		h.start = streamedAggregate
+		h.end = -1
+		h.attr = 0
+		h.arr = h.arr[:0]
+		v.reply.values = v.reply.values[:v.reply.n]
+		v.call(Value{id: 0, reply: v.reply})
+		for j := int64(0); j < size; j++ {
+			if err := v.visit(r, int(j)); err != nil {
+				return err
+			}
+		}
+		if typ != Attribute {
+			return nil
+		}
+		// Attributes are followed by the value they describe
+	}
+}
+
+func (v *visitor) call(val Value) {
+	if v.err == nil && v.fn != nil {
+		v.err = v.fn(len(v.path)-1, v.path, val)
+	}
+}
@@ -0,0 +1,94 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestReplyVisitN(t *testing.T) {
+	b := new(Buffer)
+	b.BulkString("foo")
+	b.Array(3)
+	b.Int(1)
+	b.NullString()
+	b.Array(2)
+	b.SimpleString("bar")
+	b.NullArray()
+	b.Attribute(1)
+	b.SimpleString("ttl")
+	b.Int(10)
+	b.Map(1)
+	b.BulkString("baz")
+	b.Double(1.5)
+	b.Array(0)
+
+	var visits []string
+	rep := new(Reply)
+	r := bufio.NewReader(bytes.NewReader(b.B))
+	err := rep.VisitN(r, 4, func(depth int, path []int, v Value) error {
+		if depth != len(path)-1 {
+			t.Errorf("Invalid depth %d for path %v", depth, path)
+		}
+		s := fmt.Sprintf("%v %c", path, v.Type())
+		switch {
+		case v.IsNull():
+			s += " null"
+		case isAggregate(v.Type()):
+			s += fmt.Sprintf(" %d", v.Len())
+		default:
+			s += " " + string(v.Bytes())
+			if n, ok := v.Int(); ok && v.Type() == Integer {
+				s += fmt.Sprint(n)
+			}
+		}
+		visits = append(visits, s)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{
+		"[0] $ foo",
+		"[1] * 3",
+		"[1 0] : 1",
+		"[1 1] $ null",
+		"[1 2] * 2",
+		"[1 2 0] + bar",
+		"[1 2 1] * null",
+		"[2] | 2",
+		"[2 0] + ttl",
+		"[2 1] : 10",
+		"[2] % 2",
+		"[2 0] $ baz",
+		"[2 1] , 1.5",
+		"[3] * 0",
+	}
+	if !reflect.DeepEqual(visits, expect) {
+		t.Errorf("Invalid visits\n%q\n%q", visits, expect)
+	}
+
+	// Replies are discarded after an error
+	errStop := errors.New("stop")
+	visits = visits[:0]
+	r = bufio.NewReader(bytes.NewReader(append(b.B, "+OK\r\n"...)))
+	err = rep.VisitN(r, 4, func(depth int, path []int, v Value) error {
+		visits = append(visits, string(v.Bytes()))
+		if depth == 1 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop {
+		t.Errorf("Invalid error %v", err)
+	}
+	if len(visits) != 3 {
+		t.Errorf("Invalid visits %q", visits)
+	}
+	if line, _, _ := r.ReadLine(); string(line) != "+OK" {
+		t.Errorf("Stream out of sync %q", line)
+	}
+}
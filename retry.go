@@ -0,0 +1,103 @@
+package redis
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+const (
+	defaultMinRetryBackoff = 8 * time.Millisecond
+	defaultMaxRetryBackoff = 512 * time.Millisecond
+)
+
+// shouldRetry checks if a pipeline can be resent after an attempt reading its replies after mark
+func (pool *Pool) shouldRetry(p *Pipeline, r *resp.Reply, mark resp.Mark, sent bool, err error) bool {
+	if p.Streams() > 0 {
+		// Streamed arguments are consumed by the first attempt
+		return false
+	}
+	if err != nil {
+		if !isNetworkError(err) {
+			return false
+		}
+		if !sent {
+			// Nothing reached the server
+			return true
+		}
+	} else if r == nil || !hasRetryableError(r.Since(mark)) {
+		return false
+	}
+	return pool.RetryNonIdempotent || p.IsIdempotent()
+}
+
+// retryBackoff returns the delay before a retry using exponential backoff with jitter
+func (pool *Pool) retryBackoff(attempt int) time.Duration {
+	min, max := pool.MinRetryBackoff, pool.MaxRetryBackoff
+	if min <= 0 {
+		min = defaultMinRetryBackoff
+	}
+	if max <= 0 {
+		max = defaultMaxRetryBackoff
+	}
+	if max < min {
+		max = min
+	}
+	d := min
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	// Randomize the upper half of the delay to avoid retrying in lockstep
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// isNetworkError checks if an error was caused by the connection
+func isNetworkError(err error) bool {
+	switch err {
+	case io.EOF, io.ErrUnexpectedEOF, errConnClosed:
+		return true
+	}
+	_, ok := err.(net.Error)
+	return ok
+}
+
+// hasRetryableError checks if any reply is a LOADING, BUSY or TRYAGAIN error
+func hasRetryableError(v resp.Value) bool {
+	retry := false
+	v.ForEach(func(v resp.Value) {
+		if err := v.Err(); err != nil && !retry {
+			retry = isRetryableReply(err.Error())
+		}
+	})
+	return retry
+}
+
+func isRetryableReply(msg string) bool {
+	for _, prefix := range []string{"LOADING", "BUSY", "TRYAGAIN"} {
+		if strings.HasPrefix(msg, prefix) && (len(msg) == len(prefix) || msg[len(prefix)] == ' ') {
+			return true
+		}
+	}
+	return false
+}
+
+// sleepContext pauses for a duration or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
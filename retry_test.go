@@ -0,0 +1,110 @@
+package redis
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+func TestPool_DoRetry(t *testing.T) {
+	var calls int32
+	s := &fakeServer{
+		handle: func(args []string, w *resp.Buffer) {
+			if atomic.AddInt32(&calls, 1)%3 != 0 {
+				w.Error("LOADING Redis is loading the dataset in memory")
+				return
+			}
+			w.BulkString("bar")
+		},
+	}
+	var dials int32
+	pool := Pool{
+		MaxRetries:      3,
+		MinRetryBackoff: time.Millisecond,
+		Dial: func(addr string, timeout time.Duration) (net.Conn, error) {
+			if atomic.AddInt32(&dials, 1) == 1 {
+				return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+			}
+			return s.Dial(addr, timeout)
+		},
+	}
+	defer pool.Close()
+	p := BlankPipeline(0)
+	defer ReleasePipeline(p)
+	r := BlankReply()
+	defer ReleaseReply(r)
+	p.Get("foo")
+	if err := pool.Do(p, r); err != nil {
+		t.Fatal(err)
+	}
+	if v := string(r.Value().Get(0).Bytes()); v != "bar" {
+		t.Errorf("Invalid reply %q", v)
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("Invalid number of calls %d", n)
+	}
+
+	// Retries keep values read earlier into the reply
+	if err := pool.Do(p, r); err != nil {
+		t.Fatal(err)
+	}
+	if v := string(r.Value().Get(0).Bytes()); v != "bar" {
+		t.Errorf("Invalid earlier reply %q", v)
+	}
+	if n := atomic.LoadInt32(&calls); n != 6 {
+		t.Errorf("Invalid number of calls %d", n)
+	}
+
+	// Non idempotent commands are not retried
+	p.Reset()
+	r.Reset()
+	p.Incr("foo")
+	if err := pool.Do(p, r); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Value().Get(0).Err(); err == nil {
+		t.Errorf("Non idempotent pipeline was retried")
+	}
+	if n := atomic.LoadInt32(&calls); n != 7 {
+		t.Errorf("Invalid number of calls %d", n)
+	}
+}
+
+func TestPool_retryBackoff(t *testing.T) {
+	pool := Pool{
+		MinRetryBackoff: 10 * time.Millisecond,
+		MaxRetryBackoff: 50 * time.Millisecond,
+	}
+	for attempt, max := range []time.Duration{10, 20, 40, 50, 50} {
+		max *= time.Millisecond
+		d := pool.retryBackoff(attempt)
+		if d < max/2 || d > max {
+			t.Errorf("Invalid backoff for attempt %d: %s", attempt, d)
+		}
+	}
+}
+
+func TestPipeline_IsIdempotent(t *testing.T) {
+	p := BlankPipeline(0)
+	defer ReleasePipeline(p)
+	for _, build := range []func(p *Pipeline){
+		func(p *Pipeline) { p.Expire("foo", time.Second) },
+		func(p *Pipeline) { p.LTrim("foo", 1, -1) },
+		func(p *Pipeline) { p.ZIncrByNX("foo", 1, "bar") },
+	} {
+		p.Reset()
+		build(p)
+		if p.IsIdempotent() {
+			t.Errorf("Command %s is not idempotent", p.cmds[0].name)
+		}
+	}
+	p.Reset()
+	p.Del("foo")
+	if !p.IsIdempotent() {
+		t.Error("DEL is idempotent")
+	}
+}
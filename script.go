@@ -0,0 +1,231 @@
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+// Script is a Lua script with a fixed number of keys.
+//
+// Scripts are executed with EVALSHA.
+// Scripts are loaded with SCRIPT LOAD the first time a connection executes them.
+// If the server still replies with NOSCRIPT the script is loaded and the command is sent again.
+type Script struct {
+	src     string
+	sha1    string
+	numKeys int
+}
+
+// NewScript creates a script computing its SHA1 digest locally
+func NewScript(numKeys int, src string) *Script {
+	sum := sha1.Sum([]byte(src))
+	return &Script{
+		src:     src,
+		sha1:    hex.EncodeToString(sum[:]),
+		numKeys: numKeys,
+	}
+}
+
+// SHA1 returns the hex encoded SHA1 digest of the script source
+func (s *Script) SHA1() string {
+	return s.sha1
+}
+
+// Source returns the Lua source of the script
+func (s *Script) Source() string {
+	return s.src
+}
+
+// NumKeys returns the number of keys the script expects
+func (s *Script) NumKeys() int {
+	return s.numKeys
+}
+
+// RunScript executes a script with EVALSHA.
+//
+// The first s.NumKeys() arguments are the keys of the script and should be resp.Key values.
+// Scripts not yet loaded on the connection are loaded before the pipeline is sent.
+// If the script cache was flushed since, the commands failing with NOSCRIPT are
+// executed again in a second round trip, after all other commands of the pipeline.
+// Replies for pipelines executed with a nil reply cannot be checked for NOSCRIPT errors.
+func (p *Pipeline) RunScript(s *Script, keysAndArgs ...resp.Arg) {
+	numKeys := s.numKeys
+	if numKeys > len(keysAndArgs) {
+		numKeys = len(keysAndArgs)
+	}
+	p.Command("EVALSHA", len(keysAndArgs)+2)
+	p.BulkString(s.sha1)
+	p.Arg(resp.Int(int64(numKeys)))
+	p.Arg(keysAndArgs...)
+	p.cmds[len(p.cmds)-1].script = s
+	p.scripts++
+}
+
+func isNoScript(v resp.Value) bool {
+	if err := v.Err(); err != nil {
+		return strings.HasPrefix(err.Error(), "NOSCRIPT")
+	}
+	return false
+}
+
+// loadScripts loads the scripts of a pipeline that are not known to be loaded on the connection
+func (c *Conn) loadScripts(p *Pipeline) error {
+	var scripts []*Script
+	for i := 0; i < p.Len(); i++ {
+		s := p.cmds[p.offset+i].script
+		if s == nil || containsScript(scripts, s) {
+			continue
+		}
+		if _, ok := c.scripts[s.sha1]; !ok {
+			scripts = append(scripts, s)
+		}
+	}
+	if len(scripts) == 0 {
+		return nil
+	}
+	load := BlankPipeline(-1)
+	defer ReleasePipeline(load)
+	for _, s := range scripts {
+		load.ScriptLoad(s.src)
+	}
+	r := BlankReply()
+	defer ReleaseReply(r)
+	if err := c.Do(load, r); err != nil {
+		return err
+	}
+	for i, s := range scripts {
+		// Scripts failing to load are reported by their commands
+		if r.Value().Get(i).Err() == nil {
+			c.loadedScript(s)
+		}
+	}
+	return nil
+}
+
+func (c *Conn) loadedScript(s *Script) {
+	if c.scripts == nil {
+		c.scripts = make(map[string]struct{})
+	}
+	c.scripts[s.sha1] = struct{}{}
+}
+
+// reloadScripts loads scripts that failed with NOSCRIPT and executes their commands again.
+// Values read before mark are kept.
+func (c *Conn) reloadScripts(p *Pipeline, reply *resp.Reply, mark resp.Mark, v resp.Value) error {
+	var (
+		failed []int
+		loaded []*Script
+	)
+	for i := 0; i < p.Len(); i++ {
+		cmd := &p.cmds[p.offset+i]
+		if cmd.script == nil || !isNoScript(v.Get(i)) {
+			continue
+		}
+		failed = append(failed, i)
+		if !containsScript(loaded, cmd.script) {
+			loaded = append(loaded, cmd.script)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	retry := BlankPipeline(-1)
+	defer ReleasePipeline(retry)
+	for _, s := range loaded {
+		retry.ScriptLoad(s.src)
+	}
+	for _, i := range failed {
+		retry.appendCommand(p, p.offset+i)
+	}
+	// Scripts are not reloaded again if loading fails
+	retry.scripts = 0
+	r := BlankReply()
+	defer ReleaseReply(r)
+	if err := c.Do(retry, r); err != nil {
+		return err
+	}
+	for i, s := range loaded {
+		if r.Value().Get(i).Err() == nil {
+			c.loadedScript(s)
+		}
+	}
+	values := make([]resp.Value, v.Len())
+	for i := range values {
+		values[i] = v.Get(i)
+	}
+	for j, i := range failed {
+		values[i] = r.Value().Get(len(loaded) + j)
+	}
+	var buf []byte
+	for _, v := range values {
+		buf = v.AppendRESP(buf)
+	}
+	reply.Rewind(mark)
+	_, err := reply.ReadFromN(bufio.NewReader(bytes.NewReader(buf)), int64(len(values)))
+	return err
+}
+
+func containsScript(scripts []*Script, s *Script) bool {
+	for _, script := range scripts {
+		if script == s || script.sha1 == s.sha1 {
+			return true
+		}
+	}
+	return false
+}
+
+// ScriptRegistry is a set of scripts loaded on every new connection of a Pool
+type ScriptRegistry struct {
+	mu      sync.RWMutex
+	scripts []*Script
+}
+
+// Register adds scripts to the registry
+func (r *ScriptRegistry) Register(scripts ...*Script) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range scripts {
+		if !containsScript(r.scripts, s) {
+			r.scripts = append(r.scripts, s)
+		}
+	}
+}
+
+// Scripts returns the registered scripts
+func (r *ScriptRegistry) Scripts() []*Script {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]*Script(nil), r.scripts...)
+}
+
+// load loads all registered scripts on a connection
+func (r *ScriptRegistry) load(ctx context.Context, c *Conn) error {
+	scripts := r.Scripts()
+	if len(scripts) == 0 {
+		return nil
+	}
+	p := BlankPipeline(-1)
+	defer ReleasePipeline(p)
+	for _, s := range scripts {
+		p.ScriptLoad(s.src)
+	}
+	reply := BlankReply()
+	defer ReleaseReply(reply)
+	if err := c.DoContext(ctx, p, reply); err != nil {
+		return err
+	}
+	for i, s := range scripts {
+		if err := reply.Value().Get(i).Err(); err != nil {
+			return err
+		}
+		c.loadedScript(s)
+	}
+	return nil
+}
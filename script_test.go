@@ -51,3 +51,170 @@ func TestScript(t *testing.T) {
 	})
 
 }
+
+func TestPipeline_RunScript(t *testing.T) {
+	cache := map[string]bool{}
+	var loads int
+	s := &fakeServer{
+		handle: func(args []string, w *resp.Buffer) {
+			switch args[0] {
+			case "SCRIPT":
+				loads++
+				sum := NewScript(0, args[2]).SHA1()
+				cache[sum] = true
+				w.BulkString(sum)
+			case "EVALSHA":
+				if !cache[args[1]] {
+					w.Error("NOSCRIPT No matching script. Please use EVAL.")
+					return
+				}
+				w.BulkString(args[3] + ":" + args[4])
+			default:
+				w.SimpleString("OK")
+			}
+		},
+	}
+	script := NewScript(1, "return KEYS[1]..':'..ARGV[1]")
+	if sum := NewScript(2, "return {KEYS[1],ARGV[1],KEYS[2],ARGV[2]}").SHA1(); sum != "da95252e2c27e41cd53b9114f28b4ba84e7d64d4" {
+		t.Errorf("Invalid SHA1 %q", sum)
+	}
+	pool := Pool{Dial: s.Dial}
+	defer pool.Close()
+	p := BlankPipeline(0)
+	defer ReleasePipeline(p)
+	r := BlankReply()
+	defer ReleaseReply(r)
+	p.Set("foo", resp.String("bar"), 0)
+	p.RunScript(script, resp.Key("foo"), resp.String("bar"))
+	p.RunScript(script, resp.Key("baz"), resp.String("qux"))
+	if err := pool.Do(p, r); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"OK", "foo:bar", "baz:qux"} {
+		if v := string(r.Value().Get(i).Bytes()); v != want {
+			t.Errorf("Invalid reply %d %q != %q", i, v, want)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("Invalid number of loads %d", loads)
+	}
+
+	// Registered scripts are loaded on new connections
+	cache = map[string]bool{}
+	loads = 0
+	other := NewScript(0, "return 1")
+	pool2 := Pool{Dial: s.Dial, Scripts: new(ScriptRegistry)}
+	defer pool2.Close()
+	pool2.Scripts.Register(script, other)
+	r.Reset()
+	if err := pool2.Do(p, r); err != nil {
+		t.Fatal(err)
+	}
+	if loads != 2 {
+		t.Errorf("Invalid number of loads %d", loads)
+	}
+}
+
+func TestConn_RunScriptOrder(t *testing.T) {
+	cache := map[string]bool{}
+	var cmds []string
+	s := &fakeServer{
+		handle: func(args []string, w *resp.Buffer) {
+			cmds = append(cmds, args[0])
+			switch args[0] {
+			case "SCRIPT":
+				sum := NewScript(0, args[2]).SHA1()
+				cache[sum] = true
+				w.BulkString(sum)
+			case "EVALSHA":
+				if !cache[args[1]] {
+					w.Error("NOSCRIPT No matching script. Please use EVAL.")
+					return
+				}
+				w.BulkString(args[3])
+			default:
+				w.BulkString(args[len(args)-1])
+			}
+		},
+	}
+	nc, _ := s.Dial("", 0)
+	conn := newConn(nc, ConnOptions{})
+	defer conn.Close()
+	script := NewScript(1, "return KEYS[1]")
+	p := BlankPipeline(0)
+	defer ReleasePipeline(p)
+	r := BlankReply()
+	defer ReleaseReply(r)
+
+	// Scripts are loaded before the commands of the pipeline
+	p.RunScript(script, resp.Key("foo"))
+	p.Echo("bar")
+	if err := conn.Do(p, r); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"SCRIPT", "EVALSHA", "ECHO"}; !equalStrings(cmds, want) {
+		t.Errorf("Invalid commands %v", cmds)
+	}
+	if v := string(r.Value().Get(0).Bytes()); v != "foo" {
+		t.Errorf("Invalid reply %q", v)
+	}
+
+	// Scripts are reloaded after a flush keeping earlier values of the reply
+	cache = map[string]bool{}
+	cmds = cmds[:0]
+	p.Reset()
+	p.RunScript(script, resp.Key("baz"))
+	p.Echo("qux")
+	if err := conn.Do(p, r); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"EVALSHA", "ECHO", "SCRIPT", "EVALSHA"}; !equalStrings(cmds, want) {
+		t.Errorf("Invalid commands %v", cmds)
+	}
+	if v := string(r.Value().Get(0).Bytes()); v != "foo" {
+		t.Errorf("Invalid first reply %q", v)
+	}
+	if v := string(r.Value().Get(1).Bytes()); v != "bar" {
+		t.Errorf("Invalid second reply %q", v)
+	}
+}
+
+func TestConn_VisitRunScript(t *testing.T) {
+	cache := map[string]bool{}
+	s := &fakeServer{
+		handle: func(args []string, w *resp.Buffer) {
+			switch args[0] {
+			case "SCRIPT":
+				sum := NewScript(0, args[2]).SHA1()
+				cache[sum] = true
+				w.BulkString(sum)
+			case "EVALSHA":
+				if !cache[args[1]] {
+					w.Error("NOSCRIPT No matching script. Please use EVAL.")
+					return
+				}
+				w.BulkString(args[3])
+			}
+		},
+	}
+	nc, _ := s.Dial("", 0)
+	conn := newConn(nc, ConnOptions{})
+	defer conn.Close()
+	p := BlankPipeline(0)
+	defer ReleasePipeline(p)
+	p.RunScript(NewScript(1, "return KEYS[1]"), resp.Key("foo"))
+	var got []string
+	err := conn.Visit(p, func(depth int, path []int, v resp.Value) error {
+		if err := v.Err(); err != nil {
+			return err
+		}
+		got = append(got, string(v.Bytes()))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != "foo" {
+		t.Errorf("Invalid values %q", got)
+	}
+}
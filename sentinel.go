@@ -0,0 +1,197 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sentinel discovers the master of a service through Redis Sentinel.
+//
+// Its Dial method can be used as a Pool.Dial provider.
+// Pools registered with Watch are invalidated whenever a failover is announced
+// so that new connections are made to the new master.
+type Sentinel struct {
+	noCopy
+
+	// Addresses of the sentinels
+	Addresses []string
+	// MasterName is the name of the monitored service
+	MasterName string
+	// Username and Password authenticate connections to the sentinels
+	Username string
+	Password string
+	// DialTimeout is the timeout for connecting to sentinels and masters (default 5s)
+	DialTimeout time.Duration
+
+	mu     sync.Mutex
+	master string
+	pools  []*Pool
+	pubsub *PubSub
+	cancel context.CancelFunc
+}
+
+// ErrMasterNotFound occurs when no sentinel knows the master address
+const ErrMasterNotFound = Err("Sentinel master not found")
+
+const defaultDialTimeout = 5 * time.Second
+
+func (s *Sentinel) dialTimeout() time.Duration {
+	if s.DialTimeout > 0 {
+		return s.DialTimeout
+	}
+	return defaultDialTimeout
+}
+
+// Dial connects to the current master ignoring the address argument.
+//
+// The sentinels are asked for the master address on every call since a failed over master
+// may come back as a replica at the same address.
+// The last known address is used only if no sentinel replies.
+func (s *Sentinel) Dial(_ string, timeout time.Duration) (net.Conn, error) {
+	if timeout <= 0 {
+		timeout = s.dialTimeout()
+	}
+	addr, err := s.MasterAddress()
+	if err != nil {
+		s.mu.Lock()
+		addr = s.master
+		s.mu.Unlock()
+		if addr == "" {
+			return nil, err
+		}
+	}
+	return defaultDial(addr, timeout)
+}
+
+// MasterAddress asks the sentinels for the address of the current master
+func (s *Sentinel) MasterAddress() (string, error) {
+	err := error(ErrMasterNotFound)
+	for _, addr := range s.Addresses {
+		var master string
+		master, err = s.queryMaster(addr)
+		if err == nil {
+			s.setMaster(master)
+			return master, nil
+		}
+	}
+	return "", err
+}
+
+func (s *Sentinel) setMaster(addr string) (changed bool) {
+	s.mu.Lock()
+	changed = s.master != "" && s.master != addr
+	s.master = addr
+	s.mu.Unlock()
+	return
+}
+
+func (s *Sentinel) dialSentinel(addr string) (*Conn, error) {
+	conn, err := defaultDial(addr, s.dialTimeout())
+	if err != nil {
+		return nil, err
+	}
+	c := newConn(conn, ConnOptions{
+		ReadTimeout:  s.dialTimeout(),
+		WriteTimeout: s.dialTimeout(),
+		Username:     s.Username,
+		Password:     s.Password,
+	})
+	if err := c.handshake(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *Sentinel) queryMaster(addr string) (string, error) {
+	conn, err := s.dialSentinel(addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	p := BlankPipeline(-1)
+	defer ReleasePipeline(p)
+	p.SentinelGetMasterAddrByName(s.MasterName)
+	r := BlankReply()
+	defer ReleaseReply(r)
+	if err := conn.Do(p, r); err != nil {
+		return "", err
+	}
+	v := r.Value().Get(0)
+	if err := v.Err(); err != nil {
+		return "", err
+	}
+	if v.IsNull() || v.Len() != 2 {
+		return "", ErrMasterNotFound
+	}
+	return net.JoinHostPort(string(v.Get(0).Bytes()), string(v.Get(1).Bytes())), nil
+}
+
+// Watch sets the pool to dial the current master and invalidates
+// its connections whenever a failover is announced.
+func (s *Sentinel) Watch(pool *Pool) {
+	pool.Dial = s.Dial
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pools = append(s.pools, pool)
+	if s.pubsub != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.pubsub = &PubSub{
+		Dial: func(ctx context.Context) (*Conn, error) {
+			var err error = ErrMasterNotFound
+			for _, addr := range s.Addresses {
+				var conn *Conn
+				if conn, err = s.dialSentinel(addr); err == nil {
+					// Catch up with failovers missed while disconnected
+					if master, err := s.queryMaster(addr); err == nil && s.setMaster(master) {
+						s.invalidate()
+					}
+					return conn, nil
+				}
+			}
+			return nil, err
+		},
+	}
+	s.pubsub.Subscribe("+switch-master")
+	go s.pubsub.Run(ctx, s.onMessage)
+}
+
+// onMessage handles +switch-master events
+func (s *Sentinel) onMessage(m *Message) {
+	// <master name> <old ip> <old port> <new ip> <new port>
+	fields := strings.Fields(string(m.Payload))
+	if len(fields) != 5 || fields[0] != s.MasterName {
+		return
+	}
+	if s.setMaster(net.JoinHostPort(fields[3], fields[4])) {
+		s.invalidate()
+	}
+}
+
+func (s *Sentinel) invalidate() {
+	s.mu.Lock()
+	pools := append([]*Pool(nil), s.pools...)
+	s.mu.Unlock()
+	for _, pool := range pools {
+		pool.Invalidate()
+	}
+}
+
+// Close stops watching for failovers
+func (s *Sentinel) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pubsub == nil {
+		return nil
+	}
+	s.cancel()
+	err := s.pubsub.Close()
+	s.pubsub, s.cancel, s.pools = nil, nil, nil
+	return err
+}
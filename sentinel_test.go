@@ -0,0 +1,137 @@
+package redis
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+func TestSentinel_Failover(t *testing.T) {
+	masters := make([]string, 2)
+	for i, name := range []string{"m1", "m2"} {
+		name := name
+		m := &fakeServer{
+			handle: func(args []string, w *resp.Buffer) {
+				w.BulkString(name)
+			},
+		}
+		addr, stop := m.listen(t)
+		defer stop()
+		masters[i] = addr
+	}
+	var mu sync.Mutex
+	current := masters[0]
+	sentinel := &fakeServer{
+		handle: func(args []string, w *resp.Buffer) {
+			mu.Lock()
+			defer mu.Unlock()
+			host, port, _ := net.SplitHostPort(current)
+			w.BulkStringArray(host, port)
+		},
+	}
+	addr, stop := sentinel.listen(t)
+	defer stop()
+
+	s := Sentinel{
+		Addresses:  []string{addr},
+		MasterName: "mymaster",
+	}
+	defer s.Close()
+	pool := new(Pool)
+	defer pool.Close()
+	s.Watch(pool)
+
+	get := func() string {
+		p := BlankPipeline(0)
+		defer ReleasePipeline(p)
+		p.Get("foo")
+		r := BlankReply()
+		defer ReleaseReply(r)
+		if err := pool.Do(p, r); err != nil {
+			t.Fatal(err)
+		}
+		return string(r.Value().Get(0).Bytes())
+	}
+	if name := get(); name != "m1" {
+		t.Fatalf("Invalid master %q", name)
+	}
+	mu.Lock()
+	current = masters[1]
+	mu.Unlock()
+	host, port, _ := net.SplitHostPort(masters[1])
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		// Retry until the subscription is established
+		sentinel.publish("+switch-master", "mymaster 127.0.0.1 1 "+host+" "+port)
+		if get() == "m2" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Pool did not switch to the new master")
+}
+
+func TestSentinel_DialDemotedMaster(t *testing.T) {
+	masters := make([]string, 2)
+	for i, name := range []string{"m1", "m2"} {
+		name := name
+		m := &fakeServer{
+			handle: func(args []string, w *resp.Buffer) {
+				w.BulkString(name)
+			},
+		}
+		addr, stop := m.listen(t)
+		defer stop()
+		masters[i] = addr
+	}
+	var mu sync.Mutex
+	current := masters[0]
+	sentinel := &fakeServer{
+		handle: func(args []string, w *resp.Buffer) {
+			mu.Lock()
+			defer mu.Unlock()
+			host, port, _ := net.SplitHostPort(current)
+			w.BulkStringArray(host, port)
+		},
+	}
+	addr, stop := sentinel.listen(t)
+	s := Sentinel{
+		Addresses:  []string{addr},
+		MasterName: "mymaster",
+	}
+	get := func() string {
+		nc, err := s.Dial("", time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn := newConn(nc, ConnOptions{})
+		defer conn.Close()
+		p := BlankPipeline(0)
+		defer ReleasePipeline(p)
+		p.Get("foo")
+		r := BlankReply()
+		defer ReleaseReply(r)
+		if err := conn.Do(p, r); err != nil {
+			t.Fatal(err)
+		}
+		return string(r.Value().Get(0).Bytes())
+	}
+	if name := get(); name != "m1" {
+		t.Fatalf("Invalid master %q", name)
+	}
+	// The old master is still reachable but no longer the master
+	mu.Lock()
+	current = masters[1]
+	mu.Unlock()
+	if name := get(); name != "m2" {
+		t.Errorf("Invalid master after failover %q", name)
+	}
+	// The last known master is used while sentinels are down
+	stop()
+	if name := get(); name != "m2" {
+		t.Errorf("Invalid master without sentinels %q", name)
+	}
+}
@@ -0,0 +1,96 @@
+package redis
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+// fakeServer serves RESP commands over in-memory or local TCP connections
+type fakeServer struct {
+	handle func(args []string, w *resp.Buffer)
+	// subscribed receives a value after each SUBSCRIBE is confirmed if not nil
+	subscribed chan struct{}
+
+	mu   sync.Mutex
+	subs []net.Conn
+}
+
+func (s *fakeServer) Dial(string, time.Duration) (net.Conn, error) {
+	client, server := net.Pipe()
+	go s.serve(server)
+	return client, nil
+}
+
+// listen serves connections on a local TCP address
+func (s *fakeServer) listen(t *testing.T) (addr string, stop func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return ln.Addr().String(), func() { ln.Close() }
+}
+
+// publish sends a message to all subscribed connections
+func (s *fakeServer) publish(channel, payload string) {
+	w := resp.Buffer{}
+	w.BulkStringArray("message", channel, payload)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.subs {
+		conn.Write(w.B)
+	}
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := resp.Reply{}
+	w := resp.Buffer{}
+	var args []string
+	for {
+		reply.Reset()
+		v, err := reply.ReadFrom(r)
+		if err != nil {
+			return
+		}
+		args = args[:0]
+		v.ForEach(func(v resp.Value) {
+			args = append(args, string(v.Bytes()))
+		})
+		w.Reset()
+		switch args[0] {
+		case "SUBSCRIBE":
+			s.mu.Lock()
+			s.subs = append(s.subs, conn)
+			s.mu.Unlock()
+			for i, ch := range args[1:] {
+				w.Array(3)
+				w.BulkString("subscribe")
+				w.BulkString(ch)
+				w.Int(int64(i + 1))
+			}
+		default:
+			s.handle(args, &w)
+		}
+		if _, err := conn.Write(w.B); err != nil {
+			return
+		}
+		if args[0] == "SUBSCRIBE" && s.subscribed != nil {
+			s.subscribed <- struct{}{}
+		}
+	}
+}
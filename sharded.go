@@ -0,0 +1,217 @@
+package redis
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+// ShardedPool distributes keys across standalone Redis nodes.
+//
+// Keys are mapped to nodes using a ketama compatible consistent hash ring.
+// If a key contains a hash tag like {user:1} only the tag is hashed.
+type ShardedPool struct {
+	noCopy
+
+	// Addresses are the initial nodes of the ring
+	Addresses []string
+	// NewPool creates a pool for a node address
+	NewPool func(address string) *Pool
+
+	mu     sync.RWMutex
+	ring   *hashRing
+	pools  map[string]*Pool
+	closed bool
+}
+
+// ErrNoShards occurs when a sharded pool has no nodes
+const ErrNoShards = Err("No shards available")
+
+// errShardRemoved occurs when a pipeline is routed to a node removed from the ring meanwhile
+const errShardRemoved = Err("Shard removed")
+
+// Do executes a pipeline splitting commands to the nodes serving their keys.
+//
+// Replies are put back in the original command order.
+// Commands are routed by their first key; commands without keys are sent to a random node.
+// Pipelines with MULTI/EXEC are rejected; run transactions on the Pool returned by Node.
+func (s *ShardedPool) Do(p *Pipeline, r *resp.Reply) error {
+	ring, err := s.loadRing()
+	if err != nil {
+		return err
+	}
+	batches, err := splitPipeline(p, func(cmd *command) (*Pool, error) {
+		return s.route(ring, cmd)
+	})
+	if err != nil {
+		return err
+	}
+	defer releaseBatches(batches)
+	doBatches(batches)
+	values := make([]resp.Value, p.Len())
+	if err := collectBatches(values, batches); err != nil {
+		return err
+	}
+	return mergeReplies(r, values)
+}
+
+// Node returns the address of the node serving a key
+func (s *ShardedPool) Node(key string) string {
+	ring, err := s.loadRing()
+	if err != nil {
+		return ""
+	}
+	return ring.node(key)
+}
+
+// Nodes returns the addresses of all nodes in the ring
+func (s *ShardedPool) Nodes() []string {
+	ring, err := s.loadRing()
+	if err != nil {
+		return nil
+	}
+	return append([]string(nil), ring.nodes...)
+}
+
+// AddNode adds a node to the ring
+func (s *ShardedPool) AddNode(addr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errPoolClosed
+	}
+	nodes := s.nodes()
+	if containsString(nodes, addr) {
+		return nil
+	}
+	s.ring = newHashRing(append(nodes, addr))
+	return nil
+}
+
+// RemoveNode removes a node from the ring and closes its pool
+func (s *ShardedPool) RemoveNode(addr string) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errPoolClosed
+	}
+	var nodes []string
+	for _, node := range s.nodes() {
+		if node != addr {
+			nodes = append(nodes, node)
+		}
+	}
+	s.ring = newHashRing(nodes)
+	pool := s.pools[addr]
+	delete(s.pools, addr)
+	s.mu.Unlock()
+	if pool != nil {
+		pool.Close()
+	}
+	return nil
+}
+
+// Moved reports how many of the keys would be served by a different node
+// if the ring consisted of addrs
+func (s *ShardedPool) Moved(addrs []string, keys ...string) int {
+	ring, err := s.loadRing()
+	if err != nil {
+		return 0
+	}
+	next := newHashRing(addrs)
+	n := 0
+	for _, key := range keys {
+		if ring.node(key) != next.node(key) {
+			n++
+		}
+	}
+	return n
+}
+
+// Close closes all node pools
+func (s *ShardedPool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errPoolClosed
+	}
+	s.closed = true
+	for addr, pool := range s.pools {
+		pool.Close()
+		delete(s.pools, addr)
+	}
+	return nil
+}
+
+// nodes returns a copy of the current ring nodes, must be called with the lock held
+func (s *ShardedPool) nodes() []string {
+	if s.ring != nil {
+		return append([]string(nil), s.ring.nodes...)
+	}
+	return append([]string(nil), s.Addresses...)
+}
+
+func (s *ShardedPool) loadRing() (*hashRing, error) {
+	s.mu.RLock()
+	ring, closed := s.ring, s.closed
+	s.mu.RUnlock()
+	if closed {
+		return nil, errPoolClosed
+	}
+	if ring != nil {
+		return ring, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ring == nil {
+		s.ring = newHashRing(append([]string(nil), s.Addresses...))
+	}
+	return s.ring, nil
+}
+
+// route returns the pool for the node serving the key of a command
+func (s *ShardedPool) route(ring *hashRing, cmd *command) (*Pool, error) {
+	if len(ring.nodes) == 0 {
+		return nil, ErrNoShards
+	}
+	if !cmd.hasKey {
+		return s.pool(ring.nodes[rand.Intn(len(ring.nodes))])
+	}
+	return s.pool(ring.node(cmd.key))
+}
+
+// pool returns the pool for a node address creating it if needed
+func (s *ShardedPool) pool(addr string) (*Pool, error) {
+	s.mu.RLock()
+	pool, closed := s.pools[addr], s.closed
+	s.mu.RUnlock()
+	if closed {
+		return nil, errPoolClosed
+	}
+	if pool != nil {
+		return pool, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, errPoolClosed
+	}
+	if pool = s.pools[addr]; pool != nil {
+		return pool, nil
+	}
+	if !containsString(s.nodes(), addr) {
+		// The caller routed with a ring from before the node was removed
+		return nil, errShardRemoved
+	}
+	if s.NewPool != nil {
+		pool = s.NewPool(addr)
+	} else {
+		pool = &Pool{Address: addr}
+	}
+	if s.pools == nil {
+		s.pools = make(map[string]*Pool)
+	}
+	s.pools[addr] = pool
+	return pool, nil
+}
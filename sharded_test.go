@@ -0,0 +1,101 @@
+package redis
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+func TestShardedPool_Do(t *testing.T) {
+	nodes := map[string]*fakeServer{}
+	for _, addr := range []string{"10.0.0.1:6379", "10.0.0.2:6379", "10.0.0.3:6379"} {
+		addr := addr
+		nodes[addr] = &fakeServer{
+			handle: func(args []string, w *resp.Buffer) {
+				w.BulkString(addr + " " + args[1])
+			},
+		}
+	}
+	s := ShardedPool{
+		Addresses: []string{"10.0.0.1:6379", "10.0.0.2:6379"},
+		NewPool: func(addr string) *Pool {
+			return &Pool{Address: addr, Dial: nodes[addr].Dial}
+		},
+	}
+	defer s.Close()
+
+	p := BlankPipeline(0)
+	defer ReleasePipeline(p)
+	r := BlankReply()
+	defer ReleaseReply(r)
+	var keys []string
+	for i := 0; i < 20; i++ {
+		key := "key:" + strconv.Itoa(i)
+		keys = append(keys, key)
+		p.Get(key)
+	}
+	if err := s.Do(p, r); err != nil {
+		t.Fatal(err)
+	}
+	shards := map[string]bool{}
+	for i, key := range keys {
+		node := s.Node(key)
+		shards[node] = true
+		if v := string(r.Value().Get(i).Bytes()); v != node+" "+key {
+			t.Errorf("Invalid reply %d %q", i, v)
+		}
+	}
+	if len(shards) != 2 {
+		t.Errorf("Keys not distributed %v", shards)
+	}
+
+	if a, b := s.Node("{user:1}:name"), s.Node("{user:1}:email"); a != b {
+		t.Errorf("Hash tag keys on different nodes %q %q", a, b)
+	}
+
+	if n := s.Moved(s.Nodes(), keys...); n != 0 {
+		t.Errorf("Moved %d keys with the same nodes", n)
+	}
+	n := s.Moved(append(s.Nodes(), "10.0.0.3:6379"), keys...)
+	if n == 0 || n == len(keys) {
+		t.Errorf("Invalid number of moved keys %d", n)
+	}
+	if err := s.AddNode("10.0.0.3:6379"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RemoveNode("10.0.0.1:6379"); err != nil {
+		t.Fatal(err)
+	}
+	// Routing with a stale ring does not recreate the removed pool
+	if _, err := s.pool("10.0.0.1:6379"); err != errShardRemoved {
+		t.Errorf("Invalid error %v", err)
+	}
+	if _, ok := s.pools["10.0.0.1:6379"]; ok {
+		t.Error("Removed pool recreated")
+	}
+	for _, key := range keys {
+		if s.Node(key) == "10.0.0.1:6379" {
+			t.Errorf("Key %q on removed node", key)
+		}
+	}
+}
+
+func TestHashRing(t *testing.T) {
+	ring := newHashRing([]string{"a:1", "b:1", "c:1"})
+	if len(ring.points) != 3*160 {
+		t.Errorf("Invalid number of points %d", len(ring.points))
+	}
+	counts := map[string]int{}
+	for i := 0; i < 3000; i++ {
+		counts[ring.node(strconv.Itoa(i))]++
+	}
+	for node, n := range counts {
+		if n < 500 {
+			t.Errorf("Node %q has too few keys %d", node, n)
+		}
+	}
+	if node := newHashRing(nil).node("foo"); node != "" {
+		t.Errorf("Empty ring returned %q", node)
+	}
+}
@@ -0,0 +1,121 @@
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"sync"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+// batch is a part of a pipeline executed on a single pool
+type batch struct {
+	pool  *Pool
+	p     *Pipeline
+	index []int // index of each command in the original pipeline
+	reply *resp.Reply
+	err   error
+}
+
+// errSplitTransaction occurs when a pipeline split across nodes contains a transaction
+const errSplitTransaction = Err("MULTI/EXEC cannot be split across nodes")
+
+// splitPipeline groups the commands of a pipeline by the pool returned from route.
+//
+// Commands selecting a database at the start of the pipeline are skipped.
+// Pipelines with MULTI, EXEC or DISCARD are rejected since the commands of a transaction
+// could be sent to different nodes.
+func splitPipeline(p *Pipeline, route func(cmd *command) (*Pool, error)) ([]*batch, error) {
+	if p.Streams() > 0 {
+		return nil, errPipelineStreams
+	}
+	for i := p.offset; i < len(p.cmds); i++ {
+		switch p.cmds[i].name {
+		case "MULTI", "EXEC", "DISCARD":
+			return nil, errSplitTransaction
+		}
+	}
+	var batches []*batch
+	for i := p.offset; i < len(p.cmds); i++ {
+		cmd, _ := p.command(i)
+		pool, err := route(cmd)
+		if err != nil {
+			releaseBatches(batches)
+			return nil, err
+		}
+		var b *batch
+		for _, bb := range batches {
+			if bb.pool == pool {
+				b = bb
+				break
+			}
+		}
+		if b == nil {
+			b = &batch{
+				pool: pool,
+				p:    BlankPipeline(-1),
+			}
+			batches = append(batches, b)
+		}
+		b.p.appendCommand(p, i)
+		b.index = append(b.index, i-p.offset)
+	}
+	return batches, nil
+}
+
+// doBatches executes batches concurrently
+func doBatches(batches []*batch) {
+	if len(batches) == 1 {
+		b := batches[0]
+		b.reply = BlankReply()
+		b.err = b.pool.Do(b.p, b.reply)
+		return
+	}
+	wg := new(sync.WaitGroup)
+	for _, b := range batches {
+		wg.Add(1)
+		go func(b *batch) {
+			defer wg.Done()
+			b.reply = BlankReply()
+			b.err = b.pool.Do(b.p, b.reply)
+		}(b)
+	}
+	wg.Wait()
+}
+
+// collect puts the replies of all batches to values in the original order
+func collectBatches(values []resp.Value, batches []*batch) error {
+	for _, b := range batches {
+		if b.err != nil {
+			return b.err
+		}
+		v := b.reply.Value()
+		for j, i := range b.index {
+			if 0 <= i && i < len(values) {
+				values[i] = v.Get(j)
+			}
+		}
+	}
+	return nil
+}
+
+func releaseBatches(batches []*batch) {
+	for _, b := range batches {
+		ReleasePipeline(b.p)
+		ReleaseReply(b.reply)
+		b.p, b.reply = nil, nil
+	}
+}
+
+// mergeReplies reads values into a reply as if they were the replies of a single pipeline
+func mergeReplies(r *resp.Reply, values []resp.Value) error {
+	if r == nil {
+		return nil
+	}
+	var buf []byte
+	for _, v := range values {
+		buf = v.AppendRESP(buf)
+	}
+	_, err := r.ReadFromN(bufio.NewReader(bytes.NewReader(buf)), int64(len(values)))
+	return err
+}
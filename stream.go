@@ -0,0 +1,282 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+// XEntry is a stream entry
+type XEntry struct {
+	ID     string
+	Fields []XField
+}
+
+// XField is a field value pair of a stream entry
+type XField struct {
+	Field string
+	Value string
+}
+
+// Get returns the value of a field in a stream entry
+func (e *XEntry) Get(field string) (string, bool) {
+	for i := range e.Fields {
+		if f := &e.Fields[i]; f.Field == field {
+			return f.Value, true
+		}
+	}
+	return "", false
+}
+
+// XStreamEntries are the entries read from a stream
+type XStreamEntries struct {
+	Stream  string
+	Entries []XEntry
+}
+
+// ErrInvalidStreamReply occurs when a reply cannot be parsed as stream entries
+const ErrInvalidStreamReply = Err("Invalid stream reply")
+
+// ParseXEntry parses a single stream entry
+func ParseXEntry(v resp.Value) (e XEntry, err error) {
+	if err = v.Err(); err != nil {
+		return
+	}
+	if v.Len() != 2 {
+		err = ErrInvalidStreamReply
+		return
+	}
+	e.ID = string(v.Get(0).Bytes())
+	fields := v.Get(1)
+	if n := fields.MapLen(); n > 0 {
+		e.Fields = make([]XField, 0, n)
+	}
+	fields.ForEachKV(func(k []byte, v resp.Value) {
+		e.Fields = append(e.Fields, XField{
+			Field: string(k),
+			Value: string(v.Bytes()),
+		})
+	})
+	return
+}
+
+// ParseXEntries appends the stream entries of an XRANGE, XREVRANGE or XCLAIM reply to entries
+func ParseXEntries(entries []XEntry, v resp.Value) ([]XEntry, error) {
+	if err := v.Err(); err != nil {
+		return entries, err
+	}
+	for i := 0; i < v.Len(); i++ {
+		el := v.Get(i)
+		if el.IsNull() {
+			// Deleted entries are null in XCLAIM and XAUTOCLAIM replies
+			continue
+		}
+		e, err := ParseXEntry(el)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// ParseXRead appends the stream entries of an XREAD or XREADGROUP reply to streams.
+//
+// A null reply due to a timeout adds no streams.
+func ParseXRead(streams []XStreamEntries, v resp.Value) ([]XStreamEntries, error) {
+	if err := v.Err(); err != nil {
+		return streams, err
+	}
+	var err error
+	switch v.Type() {
+	case resp.Map:
+		// RESP3 replies are maps of stream to entries
+		v.ForEachKV(func(k []byte, v resp.Value) {
+			if err != nil {
+				return
+			}
+			s := XStreamEntries{Stream: string(k)}
+			s.Entries, err = ParseXEntries(nil, v)
+			streams = append(streams, s)
+		})
+	default:
+		v.ForEach(func(v resp.Value) {
+			if err != nil {
+				return
+			}
+			s := XStreamEntries{Stream: string(v.Get(0).Bytes())}
+			s.Entries, err = ParseXEntries(nil, v.Get(1))
+			streams = append(streams, s)
+		})
+	}
+	return streams, err
+}
+
+// ParseXAutoClaim parses an XAUTOCLAIM reply returning the start ID for the next call
+func ParseXAutoClaim(entries []XEntry, v resp.Value) (next string, _ []XEntry, err error) {
+	if err = v.Err(); err != nil {
+		return "", entries, err
+	}
+	next = string(v.Get(0).Bytes())
+	entries, err = ParseXEntries(entries, v.Get(1))
+	return next, entries, err
+}
+
+// XConsumer consumes a stream as a member of a consumer group.
+//
+// Entries are acknowledged once the handler returns without error.
+// Entries that failed stay pending and are reclaimed by any consumer in the group
+// once they have been idle for MinIdle.
+type XConsumer struct {
+	Pool     *Pool
+	Stream   string
+	Group    string
+	Consumer string
+	// Count is the maximum number of entries read at once (default 10)
+	Count int64
+	// Block is the time to wait for new entries (default 1s)
+	Block time.Duration
+	// MinIdle is the idle time after which pending entries are reclaimed.
+	// If it is zero pending entries are not reclaimed.
+	MinIdle time.Duration
+	// CreateGroup creates the group and the stream if they do not exist
+	CreateGroup bool
+	// Handler processes stream entries
+	Handler func(e *XEntry) error
+}
+
+// Run consumes entries until the context is done
+func (c *XConsumer) Run(ctx context.Context) error {
+	if c.Pool == nil || c.Handler == nil {
+		return Err("Invalid stream consumer")
+	}
+	if c.CreateGroup {
+		if err := c.createGroup(ctx); err != nil {
+			return err
+		}
+	}
+	var (
+		entries   []XEntry
+		err       error
+		lastClaim time.Time
+	)
+	for {
+		if c.MinIdle > 0 && time.Since(lastClaim) >= c.MinIdle {
+			lastClaim = time.Now()
+			if err := c.reclaim(ctx); err != nil {
+				return err
+			}
+		}
+		entries, err = c.read(ctx, entries[:0])
+		if err != nil {
+			return err
+		}
+		if err := c.dispatch(ctx, entries); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *XConsumer) count() int64 {
+	if c.Count > 0 {
+		return c.Count
+	}
+	return defaultScanCount
+}
+
+func (c *XConsumer) createGroup(ctx context.Context) error {
+	p := c.Pool.Pipeline()
+	defer ReleasePipeline(p)
+	p.XGroupCreate(c.Stream, c.Group, "$", true)
+	r := BlankReply()
+	defer ReleaseReply(r)
+	if err := c.Pool.DoContext(ctx, p, r); err != nil {
+		return err
+	}
+	if err := r.Value().Get(0).Err(); err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// read reads new entries for the consumer
+func (c *XConsumer) read(ctx context.Context, entries []XEntry) ([]XEntry, error) {
+	block := c.Block
+	if block <= 0 {
+		block = time.Second
+	}
+	conn, err := c.Pool.GetContext(ctx)
+	if err != nil {
+		return entries, err
+	}
+	defer c.Pool.Put(conn)
+	streams, err := conn.ReadGroup(ctx, c.Group, c.Consumer, XReadGroup{
+		XRead: XRead{
+			Count: c.count(),
+			Block: block,
+		},
+	}, XS(c.Stream, ">"))
+	for i := range streams {
+		entries = append(entries, streams[i].Entries...)
+	}
+	return entries, err
+}
+
+// reclaim claims and processes pending entries idle for more than MinIdle
+func (c *XConsumer) reclaim(ctx context.Context) error {
+	var (
+		start   = "0-0"
+		entries []XEntry
+		err     error
+	)
+	r := BlankReply()
+	defer ReleaseReply(r)
+	for {
+		p := c.Pool.Pipeline()
+		p.XAutoClaim(c.Stream, c.Group, c.Consumer, c.MinIdle, start, c.count(), false)
+		r.Reset()
+		err = c.Pool.DoContext(ctx, p, r)
+		ReleasePipeline(p)
+		if err != nil {
+			return err
+		}
+		start, entries, err = ParseXAutoClaim(entries[:0], r.Value().Get(0))
+		if err != nil {
+			return err
+		}
+		if err := c.dispatch(ctx, entries); err != nil {
+			return err
+		}
+		if start == "" || start == "0-0" {
+			return nil
+		}
+	}
+}
+
+// dispatch handles entries and acknowledges the successful ones
+func (c *XConsumer) dispatch(ctx context.Context, entries []XEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(entries))
+	for i := range entries {
+		e := &entries[i]
+		if err := c.Handler(e); err == nil {
+			ids = append(ids, e.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	p := c.Pool.Pipeline()
+	defer ReleasePipeline(p)
+	p.XAck(c.Stream, c.Group, ids...)
+	r := BlankReply()
+	defer ReleaseReply(r)
+	if err := c.Pool.DoContext(ctx, p, r); err != nil {
+		return err
+	}
+	return r.Value().Get(0).Err()
+}
@@ -0,0 +1,95 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+func TestParseXRead(t *testing.T) {
+	b := resp.Buffer{}
+	b.Array(1)
+	b.Array(2)
+	b.BulkString("events")
+	b.Array(2)
+	b.Array(2)
+	b.BulkString("1-0")
+	b.BulkStringArray("type", "login", "user", "42")
+	b.Array(2)
+	b.BulkString("2-0")
+	b.BulkStringArray("type", "logout")
+	v, err := resp.ParseValue(b.B)
+	if err != nil {
+		t.Fatal(err)
+	}
+	streams, err := ParseXRead(nil, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != 1 || streams[0].Stream != "events" {
+		t.Fatalf("Invalid streams %v", streams)
+	}
+	entries := streams[0].Entries
+	if len(entries) != 2 {
+		t.Fatalf("Invalid entries %v", entries)
+	}
+	if e := entries[0]; e.ID != "1-0" || len(e.Fields) != 2 {
+		t.Errorf("Invalid entry %v", e)
+	}
+	if user, ok := entries[0].Get("user"); !ok || user != "42" {
+		t.Errorf("Invalid field %q", user)
+	}
+	if typ, _ := entries[1].Get("type"); entries[1].ID != "2-0" || typ != "logout" {
+		t.Errorf("Invalid entry %v", entries[1])
+	}
+}
+
+func TestPipeline_XReadGroup(t *testing.T) {
+	p := BlankPipeline(0)
+	defer ReleasePipeline(p)
+	p.XReadGroup("workers", "w1", XReadGroup{XRead: XRead{Count: 5, Block: -1}}, XS("events", ">"))
+	v, err := resp.ParseValue(p.B)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var args []string
+	v.ForEach(func(v resp.Value) {
+		args = append(args, string(v.Bytes()))
+	})
+	expect := []string{"XREADGROUP", "GROUP", "workers", "w1", "COUNT", "5", "BLOCK", "0", "STREAMS", "events", ">"}
+	if len(args) != len(expect) {
+		t.Fatalf("Invalid args %q", args)
+	}
+	for i := range expect {
+		if args[i] != expect[i] {
+			t.Errorf("Invalid arg %d %q != %q", i, args[i], expect[i])
+		}
+	}
+}
+
+func TestPipeline_XTrim(t *testing.T) {
+	p := BlankPipeline(0)
+	defer ReleasePipeline(p)
+	for _, tc := range []struct {
+		options XTrim
+		expect  []string
+	}{
+		{XTrim{MaxLenZero: true}, []string{"XTRIM", "events", "MAXLEN", "0"}},
+		{XTrim{MaxLen: 10, Approx: true, Limit: 5}, []string{"XTRIM", "events", "MAXLEN", "~", "10", "LIMIT", "5"}},
+		{XTrim{MinID: "1-0"}, []string{"XTRIM", "events", "MINID", "1-0"}},
+	} {
+		p.Reset()
+		p.XTrim("events", tc.options)
+		v, err := resp.ParseValue(p.B)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var args []string
+		v.ForEach(func(v resp.Value) {
+			args = append(args, string(v.Bytes()))
+		})
+		if !equalStrings(args, tc.expect) {
+			t.Errorf("Invalid args %q", args)
+		}
+	}
+}
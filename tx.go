@@ -0,0 +1,133 @@
+package redis
+
+import (
+	"context"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+// Tx is an optimistic transaction on a reserved connection.
+//
+// Commands executed with Do run immediately while the watched keys are monitored.
+// Commands added to the Queue pipeline are executed atomically inside MULTI/EXEC.
+type Tx struct {
+	ctx   context.Context
+	conn  *Conn
+	queue *Pipeline
+}
+
+// ErrTxAborted occurs when a watched key was modified on every attempt of a transaction
+const ErrTxAborted = Err("Transaction aborted")
+
+// Do executes a pipeline immediately on the transaction connection
+func (tx *Tx) Do(p *Pipeline, r *resp.Reply) error {
+	return tx.conn.DoContext(tx.ctx, p, r)
+}
+
+// Queue returns the pipeline of commands to execute inside MULTI/EXEC
+func (tx *Tx) Queue() *Pipeline {
+	return tx.queue
+}
+
+// Transaction runs a check-and-set transaction.
+//
+// It WATCHes keys and calls fn to read values and queue commands.
+// The queued commands are executed inside MULTI/EXEC and their replies are read into r,
+// so that r.Value().Get(i) is the reply of the i-th queued command.
+// If a watched key is modified before EXEC the transaction is retried up to maxRetries times
+// before failing with ErrTxAborted.
+// If fn returns an error or queues no commands the keys are unwatched and nothing is executed.
+func (c *Conn) Transaction(ctx context.Context, r *resp.Reply, maxRetries int, fn func(tx *Tx) error, keys ...string) error {
+	tx := Tx{
+		ctx:   ctx,
+		conn:  c,
+		queue: BlankPipeline(-1),
+	}
+	defer ReleasePipeline(tx.queue)
+	p := BlankPipeline(-1)
+	defer ReleasePipeline(p)
+	scratch := BlankReply()
+	defer ReleaseReply(scratch)
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if len(keys) > 0 {
+			if err := c.watch(ctx, keys, scratch); err != nil {
+				return err
+			}
+		}
+		tx.queue.Reset()
+		if err := fn(&tx); err != nil {
+			c.unwatch(ctx, len(keys))
+			return err
+		}
+		if tx.queue.Len() == 0 {
+			c.unwatch(ctx, len(keys))
+			return nil
+		}
+		if tx.queue.Streams() > 0 {
+			c.unwatch(ctx, len(keys))
+			return errPipelineStreams
+		}
+		p.Reset()
+		if c.db > 0 {
+			p.Select(c.db)
+			p.offset++
+		}
+		p.Multi()
+		for i := 0; i < len(tx.queue.cmds); i++ {
+			p.appendCommand(tx.queue, i)
+		}
+		p.Exec()
+		scratch.Reset()
+		if err := c.DoContext(ctx, p, scratch); err != nil {
+			return err
+		}
+		exec := scratch.Value().Get(p.Len() - 1)
+		if err := exec.Err(); err != nil {
+			// EXECABORT due to errors queueing commands
+			return err
+		}
+		if exec.IsNull() {
+			continue
+		}
+		values := make([]resp.Value, 0, exec.Len())
+		exec.ForEach(func(v resp.Value) {
+			values = append(values, v)
+		})
+		return mergeReplies(r, values)
+	}
+	return ErrTxAborted
+}
+
+func (c *Conn) watch(ctx context.Context, keys []string, r *resp.Reply) error {
+	p := BlankPipeline(c.db)
+	defer ReleasePipeline(p)
+	p.Watch(keys...)
+	r.Reset()
+	if err := c.DoContext(ctx, p, r); err != nil {
+		return err
+	}
+	return r.Value().Get(0).Err()
+}
+
+// unwatch clears watched keys if there are any
+func (c *Conn) unwatch(ctx context.Context, numKeys int) {
+	if numKeys == 0 {
+		return
+	}
+	p := BlankPipeline(-1)
+	defer ReleasePipeline(p)
+	p.Unwatch()
+	c.DoContext(ctx, p, nil)
+}
+
+// Watch runs a check-and-set transaction on a connection from the pool.
+//
+// See Conn.Transaction for details.
+func (pool *Pool) Watch(ctx context.Context, r *resp.Reply, maxRetries int, fn func(tx *Tx) error, keys ...string) error {
+	conn, err := pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer pool.Put(conn)
+	return conn.Transaction(ctx, r, maxRetries, fn, keys...)
+}
@@ -0,0 +1,78 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/alxarch/fastredis/resp"
+)
+
+func TestPool_Watch(t *testing.T) {
+	var (
+		counter = 41
+		dirty   = 1 // number of EXEC calls to abort
+		queued  int
+	)
+	s := &fakeServer{
+		handle: func(args []string, w *resp.Buffer) {
+			switch args[0] {
+			case "WATCH", "MULTI", "UNWATCH":
+				w.SimpleString("OK")
+			case "GET":
+				w.BulkString(strconv.Itoa(counter))
+			case "SET":
+				queued++
+				w.SimpleString("QUEUED")
+			case "EXEC":
+				if dirty > 0 {
+					dirty--
+					queued = 0
+					w.NullArray()
+					return
+				}
+				w.Array(queued)
+				for ; queued > 0; queued-- {
+					w.SimpleString("OK")
+				}
+			}
+		},
+	}
+	pool := Pool{Dial: s.Dial}
+	defer pool.Close()
+	r := BlankReply()
+	defer ReleaseReply(r)
+	attempts := 0
+	incr := func(tx *Tx) error {
+		attempts++
+		p := BlankPipeline(-1)
+		defer ReleasePipeline(p)
+		p.Get("counter")
+		r := BlankReply()
+		defer ReleaseReply(r)
+		if err := tx.Do(p, r); err != nil {
+			return err
+		}
+		n, _ := r.Value().Get(0).Int()
+		tx.Queue().Set("counter", resp.Int(n+1), 0)
+		tx.Queue().Set("updated", resp.String("yes"), 0)
+		return nil
+	}
+	if err := pool.Watch(context.Background(), r, 0, incr, "counter"); err != ErrTxAborted {
+		t.Errorf("Unexpected error %v", err)
+	}
+	dirty = 1
+	attempts = 0
+	if err := pool.Watch(context.Background(), r, 3, incr, "counter"); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Errorf("Invalid attempts %d", attempts)
+	}
+	if n := r.Value().Len(); n != 2 {
+		t.Errorf("Invalid number of replies %d", n)
+	}
+	if v := string(r.Value().Get(1).Bytes()); v != "OK" {
+		t.Errorf("Invalid reply %q", v)
+	}
+}